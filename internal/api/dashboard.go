@@ -0,0 +1,75 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	metersPath      = "/api/meters"
+	metersInterval  = 100 * time.Millisecond // Meter ballistics run in the mixer tick, this only samples them
+	metersWriteWait = 5 * time.Second
+)
+
+//go:embed web/dashboard.html
+var dashboardHTML []byte
+
+// Same-origin only: the dashboard is served by this server
+var upgrader = websocket.Upgrader{}
+
+// GET / serves the dashboard page. It holds no data; the token is entered in the page.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(dashboardHTML)
+}
+
+// GET /api/meters upgrades to a WebSocket streaming the live meters of every guild.
+func (s *Server) handleMeters(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already answered the request
+		logger.Warn("Meters WebSocket upgrade failed", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	defer conn.Close()
+
+	// Read side only detects the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(metersInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			msg := map[string]interface{}{
+				"guilds":   s.controller.Meters(),
+				"overlays": overlayList(),
+			}
+			conn.SetWriteDeadline(time.Now().Add(metersWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/metrics"
+	"VLX_AudioBridge/internal/overlay"
+)
+
+func (s *Server) routes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/join", s.handleJoin)
+	mux.HandleFunc("/api/leave", s.handleLeave)
+	mux.HandleFunc("/api/users", s.handleUsers)
+	mux.HandleFunc("/api/users/volume", s.handleUserVolume)
+	mux.HandleFunc("/api/users/mute", s.handleUserMute)
+	mux.HandleFunc("/api/overlays", s.handleOverlays)
+	mux.HandleFunc("/api/outputs/start", s.handleOutputStart)
+	mux.HandleFunc("/api/outputs/stop", s.handleOutputStop)
+	mux.HandleFunc("/api/outputs/title", s.handleOutputTitle)
+	mux.HandleFunc("/api/health", s.handleHealth)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/", s.handleDashboard)
+	mux.HandleFunc(metersPath, s.handleMeters)
+	mux.HandleFunc(hlsPathPrefix, s.handleHLS)
+}
+
+type guildRequest struct {
+	GuildID   string `json:"guild_id"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+type titleRequest struct {
+	GuildID string `json:"guild_id"`
+	Title   string `json:"title"` // "" restores the configured title
+}
+
+type userVolumeRequest struct {
+	GuildID string  `json:"guild_id"`
+	UserID  string  `json:"user_id"`
+	Volume  float64 `json:"volume"` // 1.0 = unity, max 2.0
+}
+
+type userMuteRequest struct {
+	GuildID string `json:"guild_id"`
+	UserID  string `json:"user_id"`
+	Muted   bool   `json:"muted"`
+}
+
+// overlayRequest mirrors config.OverlayConfig.
+type overlayRequest struct {
+	URL         string            `json:"url"`
+	UserDataDir string            `json:"user_data_dir,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	CookiesFile string            `json:"cookies_file,omitempty"`
+}
+
+// overlayResponse omits header values, which usually carry credentials.
+type overlayResponse struct {
+	URL         string   `json:"url"`
+	UserDataDir string   `json:"user_data_dir,omitempty"`
+	Headers     []string `json:"headers,omitempty"`
+	CookiesFile string   `json:"cookies_file,omitempty"`
+}
+
+// GET /api/status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": s.controller.Sessions(),
+		"overlays": overlayList(),
+	})
+}
+
+// POST /api/join {"guild_id", "channel_id"}
+func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req guildRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.GuildID == "" || req.ChannelID == "" {
+		writeError(w, http.StatusBadRequest, "guild_id and channel_id are required")
+		return
+	}
+	if err := s.controller.Join(req.GuildID, req.ChannelID); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "joined"})
+}
+
+// POST /api/leave {"guild_id"}
+func (s *Server) handleLeave(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req guildRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.GuildID == "" {
+		writeError(w, http.StatusBadRequest, "guild_id is required")
+		return
+	}
+	if !s.controller.Leave(req.GuildID) {
+		writeError(w, http.StatusNotFound, "no active bridge in this guild")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "left"})
+}
+
+// GET /api/users?guild_id=...
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	users, err := s.controller.Users(r.URL.Query().Get("guild_id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+}
+
+// POST /api/users/volume {"guild_id", "user_id", "volume"}
+func (s *Server) handleUserVolume(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req userVolumeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.GuildID == "" || req.UserID == "" {
+		writeError(w, http.StatusBadRequest, "guild_id and user_id are required")
+		return
+	}
+	if err := s.controller.SetUserVolume(req.GuildID, req.UserID, req.Volume); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// POST /api/users/mute {"guild_id", "user_id", "muted"}
+func (s *Server) handleUserMute(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req userMuteRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.GuildID == "" || req.UserID == "" {
+		writeError(w, http.StatusBadRequest, "guild_id and user_id are required")
+		return
+	}
+	if err := s.controller.SetUserMute(req.GuildID, req.UserID, req.Muted); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /api/overlays, POST /api/overlays {overlay}, DELETE /api/overlays?url=...
+func (s *Server) handleOverlays(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"overlays": overlayList()})
+	case http.MethodPost:
+		var req overlayRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.URL == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+		err := overlay.Add(config.OverlayConfig{
+			URL:         req.URL,
+			UserDataDir: req.UserDataDir,
+			Headers:     req.Headers,
+			CookiesFile: req.CookiesFile,
+		})
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"status": "added"})
+	case http.MethodDelete:
+		url := r.URL.Query().Get("url")
+		if !overlay.Remove(url) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("overlay %q is not running", url))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+	}
+}
+
+// POST /api/outputs/start {"guild_id"}
+func (s *Server) handleOutputStart(w http.ResponseWriter, r *http.Request) {
+	s.handleOutput(w, r, s.controller.StartOutput, "started")
+}
+
+// POST /api/outputs/stop {"guild_id"}
+func (s *Server) handleOutputStop(w http.ResponseWriter, r *http.Request) {
+	s.handleOutput(w, r, s.controller.StopOutput, "stopped")
+}
+
+// POST /api/outputs/title {"guild_id", "title"}
+func (s *Server) handleOutputTitle(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req titleRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.GuildID == "" {
+		writeError(w, http.StatusBadRequest, "guild_id is required")
+		return
+	}
+	if err := s.controller.SetStreamTitle(req.GuildID, req.Title); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleOutput(w http.ResponseWriter, r *http.Request, op func(guildID string) error, status string) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req guildRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.GuildID == "" {
+		writeError(w, http.StatusBadRequest, "guild_id is required")
+		return
+	}
+	if err := op(req.GuildID); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+func overlayList() []overlayResponse {
+	overlays := overlay.List()
+	list := make([]overlayResponse, 0, len(overlays))
+	for _, o := range overlays {
+		resp := overlayResponse{URL: o.URL, UserDataDir: o.UserDataDir, CookiesFile: o.CookiesFile}
+		for name := range o.Headers {
+			resp.Headers = append(resp.Headers, name)
+		}
+		list = append(list, resp)
+	}
+	return list
+}
+
+// GET /healthz: liveness (the bot is responsive). Public, so it returns the
+// status only and runs no other check.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	live := s.controller.Live()
+	writeJSON(w, probeStatus(live), map[string]bool{"live": live})
+}
+
+// GET /readyz: readiness (every check, including voice and capture of active bridges).
+// Public, so the checks themselves are left to /api/health.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	report := s.controller.Health()
+	writeJSON(w, probeStatus(report.Ready), map[string]bool{"ready": report.Ready})
+}
+
+// GET /api/health: every check with its detail
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	report := s.controller.Health()
+	writeJSON(w, probeStatus(report.Ready), report)
+}
+
+func probeStatus(ok bool) int {
+	if ok {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
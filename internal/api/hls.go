@@ -0,0 +1,57 @@
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"VLX_AudioBridge/internal/stream"
+)
+
+const hlsPathPrefix = "/hls/"
+
+//go:embed web/player.html
+var playerHTML []byte
+
+// GET /hls/<mount>/ serves a minimal audio player, /hls/<mount>/<file> the
+// playlist and segments of the HLS output with that mount. No token: these are for listeners.
+func (s *Server) handleHLS(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	mount, file, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, hlsPathPrefix), "/")
+	if !ok {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	dir, found := stream.HLSDirectory(mount)
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no HLS output at %s", mount))
+		return
+	}
+	// Players embedded on other sites fetch the playlist cross-origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if file == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(playerHTML)
+		return
+	}
+	if file != filepath.Base(file) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	switch filepath.Ext(file) {
+	case ".m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+	case ".m4s", ".mp4":
+		w.Header().Set("Content-Type", "audio/mp4")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(dir, file))
+}
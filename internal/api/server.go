@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"VLX_AudioBridge/internal/bot"
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
+	"VLX_AudioBridge/internal/stream"
+)
+
+// Controller is the set of bridge operations exposed over HTTP. *bot.Bot implements it.
+type Controller interface {
+	Join(guildID, channelID string) error
+	Leave(guildID string) bool
+	Sessions() []bot.SessionStatus
+	Users(guildID string) ([]stream.UserSettings, error)
+	SetUserVolume(guildID, userID string, volume float64) error
+	SetUserMute(guildID, userID string, muted bool) error
+	StartOutput(guildID string) error
+	StopOutput(guildID string) error
+	SetStreamTitle(guildID, title string) error
+	Health() bot.HealthReport
+	Live() bool
+	Meters() []bot.GuildMeters
+}
+
+// Probe endpoints and the static dashboard page are served without the token.
+var publicPaths = map[string]bool{
+	"/":        true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+var (
+	logger   = logging.For(logging.API)
+	auditLog = logging.For(logging.Audit)
+)
+
+// Server is the local HTTP control API.
+type Server struct {
+	config     config.HTTPConfig
+	controller Controller
+	httpServer *http.Server
+}
+
+func New(cfg config.HTTPConfig, controller Controller) *Server {
+	s := &Server{
+		config:     cfg,
+		controller: controller,
+	}
+
+	mux := http.NewServeMux()
+	s.routes(mux)
+
+	s.httpServer = &http.Server{
+		Addr:              cfg.Bind,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Start listens in the background. A bind failure is returned immediately.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.config.Bind)
+	if err != nil {
+		return err
+	}
+	logger.Info("Listening", "addr", ln.Addr().String())
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server error", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts the server down, waiting briefly for in-flight requests.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		logger.Error("Shutdown error", "err", err)
+	}
+}
+
+// authenticate requires "Authorization: Bearer <token>" on every request except probes,
+// the dashboard page and HLS listeners.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	expected := []byte(s.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, hlsPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.URL.Path == metersPath {
+			// Browsers can't set headers on WebSocket requests
+			token, ok = r.URL.Query().Get("token"), true
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+			auditLog.Warn("Rejected API request: bad token", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Error writing response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// readJSON decodes a request body, rejecting unknown fields.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// allowMethods answers 405 unless the request uses one of the given methods.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
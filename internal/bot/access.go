@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"VLX_AudioBridge/internal/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// authorize applies the permissions policy to a command.
+// The application owner may run everything; other members need a matching user ID or role
+// in the command rule, or in the default rule when the command has none.
+func (b *Bot) authorize(m *discordgo.MessageCreate, cmd string) bool {
+	if b.OwnerID != "" && m.Author.ID == b.OwnerID {
+		return true
+	}
+
+	rule, ok := b.Config.Permissions.Commands[cmd]
+	if !ok {
+		rule = b.Config.Permissions.Default
+	}
+
+	var roles []string
+	if m.Member != nil {
+		roles = m.Member.Roles
+	}
+	return ruleAllows(rule, m.Author.ID, roles)
+}
+
+func ruleAllows(rule config.PermissionRule, userID string, roles []string) bool {
+	if contains(rule.Users, userID) {
+		return true
+	}
+	for _, role := range roles {
+		if contains(rule.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedGuilds returns the guild restriction from config (guild_id plus allowed_guilds).
+// An empty result means every guild is accepted.
+func (b *Bot) allowedGuilds() []string {
+	guilds := b.Config.Discord.AllowedGuilds
+	if b.Config.Discord.GuildID != "" {
+		guilds = append([]string{b.Config.Discord.GuildID}, guilds...)
+	}
+	return guilds
+}
+
+// guildAllowed reports whether the bot may operate in the given guild.
+func (b *Bot) guildAllowed(guildID string) bool {
+	guilds := b.allowedGuilds()
+	if len(guilds) == 0 {
+		return true
+	}
+	return contains(guilds, guildID)
+}
+
+// commandChannelAllowed reports whether commands are accepted from the given text channel.
+func (b *Bot) commandChannelAllowed(channelID string) bool {
+	channels := b.Config.Discord.AllowedChannels
+	return len(channels) == 0 || contains(channels, channelID)
+}
+
+func contains(list []string, id string) bool {
+	for _, item := range list {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+// autoJoin starts the configured bridges so the service recovers unattended after a restart.
+// Called on every gateway Ready; guilds that are active or already retrying are left alone.
+func (b *Bot) autoJoin() {
+	for _, target := range b.Config.Discord.AutoJoin {
+		sess := b.session(target.GuildID)
+		stop, ok := sess.beginAutoJoin()
+		if !ok {
+			continue
+		}
+		go b.autoJoinLoop(sess, target, stop)
+	}
+}
+
+// beginAutoJoin registers the session's auto-join loop. Returns false if the session
+// is active or a loop is already running.
+func (gs *GuildSession) beginAutoJoin() (chan struct{}, bool) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	if gs.voiceConnection != nil || gs.reconnectCancel != nil || gs.autoJoinCancel != nil {
+		return nil, false
+	}
+	gs.autoJoinCancel = make(chan struct{})
+	return gs.autoJoinCancel, true
+}
+
+// endAutoJoin unregisters the loop owning stop.
+func (gs *GuildSession) endAutoJoin(stop chan struct{}) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	if gs.autoJoinCancel == stop {
+		gs.autoJoinCancel = nil
+	}
+}
+
+// cancelAutoJoin stops a pending auto-join loop (leave). Returns false if none was running.
+func (gs *GuildSession) cancelAutoJoin() bool {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	if gs.autoJoinCancel == nil {
+		return false
+	}
+	close(gs.autoJoinCancel)
+	gs.autoJoinCancel = nil
+	return true
+}
+
+// autoJoinPending reports whether an auto-join loop is running.
+func (gs *GuildSession) autoJoinPending() bool {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	return gs.autoJoinCancel != nil
+}
+
+// autoJoinLoop retries the join with backoff, e.g. while the network is still coming up at boot,
+// until it succeeds, fails for good (permissions, missing device), runs out of attempts or is
+// cancelled by leave.
+func (b *Bot) autoJoinLoop(sess *GuildSession, target config.AutoJoinConfig, stop chan struct{}) {
+	defer sess.endAutoJoin(stop)
+	backoff := time.Second
+	maxAttempts := b.Config.Discord.ReconnectMaxAttempts
+
+	for attempt := 1; maxAttempts <= 0 || attempt <= maxAttempts; attempt++ {
+		// A manual join/follow may have happened meanwhile
+		if sess.active() {
+			return
+		}
+
+		err := sess.Start(target.ChannelID, target.NotifyChannelID)
+		if err == nil {
+			select {
+			case <-stop:
+				// Left while we were joining
+				sess.Stop()
+				return
+			default:
+			}
+			sess.log.Info("Auto-joined", "channel", target.ChannelID)
+			if target.NotifyChannelID != "" {
+				b.Session.ChannelMessageSend(target.NotifyChannelID, "Audio Bridge Active (auto-join).")
+			}
+			return
+		}
+
+		if isPermanent(err) {
+			sess.log.Error("Auto-join failed, not retrying", "channel", target.ChannelID, "err", err)
+			if target.NotifyChannelID != "" {
+				b.Session.ChannelMessageSend(target.NotifyChannelID, fmt.Sprintf("Error: Auto-join failed: %v", err))
+			}
+			return
+		}
+		sess.log.Warn("Auto-join attempt failed", "attempt", attempt, "channel", target.ChannelID, "retry_in", backoff, "err", err)
+		select {
+		case <-stop:
+			sess.log.Info("Auto-join cancelled", "channel", target.ChannelID)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+	sess.log.Error("Giving up auto-join", "channel", target.ChannelID)
+}
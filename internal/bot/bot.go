@@ -1,33 +1,46 @@
 package bot
 
 import (
-	"context"
+	"bytes"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
-	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
 	"VLX_AudioBridge/internal/overlay"
-	"VLX_AudioBridge/internal/stream"
+	"VLX_AudioBridge/internal/tts"
+)
+
+var (
+	logger   = logging.For(logging.Bot)
+	auditLog = logging.For(logging.Audit)
 )
 
 type Bot struct {
-	Session         *discordgo.Session
-	Config          *config.Config
-	StreamManager   *stream.Manager
-	VoiceConnection *discordgo.VoiceConnection
-	StopCaptureChan chan struct{}
-	OwnerID         string
-	ShutdownChan    chan os.Signal // Channel to signal main process termination
+	Session      *discordgo.Session
+	Config       *config.Config
+	Soundboard   *overlay.Soundboard // Decoded clips, cloned per guild session
+	TTS          tts.Engine
+	OwnerID      string
+	ShutdownChan chan os.Signal // Channel to signal main process termination
+
+	mutex        sync.Mutex
+	sessions     map[string]*GuildSession // Keyed by guild ID
+	destinations map[string]string        // Output destination -> guild whose bridge publishes to it
+
+	probeMutex sync.Mutex
+	probe      chan struct{} // Closed when the in-flight responsiveness probe finishes, nil if none
 }
 
 // New initializes a new Bot instance.
 // Updated to accept the shutdown channel.
-func New(cfg *config.Config, sm *stream.Manager, shutdownChan chan os.Signal) (*Bot, error) {
+func New(cfg *config.Config, shutdownChan chan os.Signal) (*Bot, error) {
 	dg, err := discordgo.New("Bot " + cfg.Discord.Token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create discord session: %w", err)
@@ -36,15 +49,29 @@ func New(cfg *config.Config, sm *stream.Manager, shutdownChan chan os.Signal) (*
 	// Set required intents
 	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsGuildVoiceStates
 
+	soundboard, err := overlay.LoadSoundboard(cfg.Soundboard)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load soundboard: %w", err)
+	}
+
+	ttsEngine, err := tts.New(cfg.TTS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize TTS: %w", err)
+	}
+
 	b := &Bot{
-		Session:       dg,
-		Config:        cfg,
-		StreamManager: sm,
-		ShutdownChan:  shutdownChan,
+		Session:      dg,
+		Config:       cfg,
+		Soundboard:   soundboard,
+		TTS:          ttsEngine,
+		ShutdownChan: shutdownChan,
+		sessions:     make(map[string]*GuildSession),
+		destinations: make(map[string]string),
 	}
 
 	dg.AddHandler(b.onReady)
 	dg.AddHandler(b.onMessageCreate)
+	dg.AddHandler(b.onVoiceStateUpdate)
 
 	return b, nil
 }
@@ -55,48 +82,27 @@ func (b *Bot) Open() error {
 
 func (b *Bot) Close() {
 	// Graceful shutdown: stop capture goroutines before disconnecting voice
-	if b.StopCaptureChan != nil {
-		select {
-		case <-b.StopCaptureChan:
-			// Channel already closed
-		default:
-			close(b.StopCaptureChan)
-		}
-		// Allow time for goroutines to terminate
-		time.Sleep(100 * time.Millisecond)
-	}
-
-	if b.VoiceConnection != nil {
-		// Context is required by the ozraru fork
-		b.VoiceConnection.Disconnect(context.Background())
+	for _, sess := range b.allSessions() {
+		sess.Stop()
 	}
 	b.Session.Close()
 }
 
-func (b *Bot) isOwner(userID string) bool {
-	if b.OwnerID != "" && userID == b.OwnerID {
-		return true
-	}
-	for _, allowedID := range b.Config.Streaming.ExcludedUsers {
-		if userID == allowedID {
-			return true
-		}
-	}
-	return false
-}
-
 // --- Event Handlers ---
 
 func (b *Bot) onReady(s *discordgo.Session, r *discordgo.Ready) {
-	log.Printf("[Bot] Session started. Logged in as: %s#%s", s.State.User.Username, s.State.User.Discriminator)
+	logger.Info("Session started", "user", s.State.User.Username+"#"+s.State.User.Discriminator, "user_id", s.State.User.ID)
 	
 	app, err := s.Application("@me")
 	if err != nil {
-		log.Printf("[Bot] Warning: Failed to fetch application info: %v", err)
+		logger.Warn("Failed to fetch application info", "err", err)
 	} else if app.Owner != nil {
 		b.OwnerID = app.Owner.ID
-		log.Printf("[Bot] Owner detected: %s. Commands restricted to this user.", b.OwnerID)
+		logger.Info("Owner detected. Owner may run every command.", "user", b.OwnerID)
 	}
+
+	// Bring up the configured bridges without waiting for a "join" command
+	b.autoJoin()
 }
 
 func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -104,10 +110,6 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate)
 		return
 	}
 
-	if !b.isOwner(m.Author.ID) {
-		return
-	}
-
 	rawContent := strings.TrimPrefix(m.Content, b.Config.Discord.Prefix)
 	parts := strings.Fields(rawContent)
 	
@@ -118,6 +120,18 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate)
 	cmd := parts[0]
 	args := parts[1:]
 
+	// Guild and command channel restrictions (DMs have no guild and are rejected when restricted)
+	if !b.guildAllowed(m.GuildID) || !b.commandChannelAllowed(m.ChannelID) {
+		logger.Info("Ignoring command: not allowed by config", "command", cmd, "user", m.Author.ID, "guild", m.GuildID, "channel", m.ChannelID)
+		return
+	}
+
+	if !b.authorize(m, cmd) {
+		auditLog.Warn("Denied command", "command", cmd, "user", m.Author.ID, "username", m.Author.Username,
+			"guild", m.GuildID, "channel", m.ChannelID)
+		return
+	}
+
 	switch cmd {
 	case "join":
 		b.handleJoin(s, m, args)
@@ -125,6 +139,28 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate)
 		b.handleLeave(s, m)
 	case "shutdown":
 		b.handleShutdown(s, m)
+	case "play":
+		b.handlePlay(s, m, args)
+	case "skip":
+		b.handleSkip(s, m)
+	case "stop":
+		b.handleStop(s, m)
+	case "volume":
+		b.handleVolume(s, m, args)
+	case "queue":
+		b.handleQueue(s, m)
+	case "sfx":
+		b.handleSfx(s, m, args)
+	case "say":
+		b.handleSay(s, m, args)
+	case "devices":
+		b.handleDevices(s, m)
+	case "status":
+		b.handleStatus(s, m)
+	case "follow":
+		b.handleFollow(s, m, args)
+	case "clip":
+		b.handleClip(s, m, args)
 	}
 }
 
@@ -147,96 +183,298 @@ func (b *Bot) handleJoin(s *discordgo.Session, m *discordgo.MessageCreate, args
 		return
 	}
 
-	// Join Voice Channel using context (required by ozraru fork)
-	vc, err := s.ChannelVoiceJoin(context.Background(), m.GuildID, channelID, false, false)
-	if err != nil {
-		log.Printf("[Bot] Voice connection failed: %v", err)
-		s.ChannelMessageSend(m.ChannelID, "Error: Failed to join voice channel.")
+	// An explicit channel ID must be a voice channel of this guild
+	if err := b.validateVoiceChannel(m.GuildID, channelID); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Error: Not a voice channel of this server.")
 		return
 	}
-	b.VoiceConnection = vc
 
-	s.ChannelMessageSend(m.ChannelID, "Connected. Stabilizing voice uplink...")
+	if err := b.startSession(m.GuildID, channelID, m.ChannelID); err != nil {
+		logger.Error("Voice connection failed", "guild", m.GuildID, "channel", channelID, "err", err)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
+		return
+	}
 
-	// --- Connection Stabilization Logic ---
-	
-	// 1. Wait for UDP Handshake completion
-	time.Sleep(1 * time.Second)
+	s.ChannelMessageSend(m.ChannelID, "Audio Bridge Active.")
+}
 
-	// 2. Set Speaking status to allow UDP ingress
-	if err := vc.Speaking(true); err != nil {
-		log.Printf("[Bot] Warning: Failed to set speaking status: %v", err)
+func (b *Bot) handleLeave(s *discordgo.Session, m *discordgo.MessageCreate) {
+	// Leaving explicitly also ends follow mode
+	if b.Leave(m.GuildID) {
+		s.ChannelMessageSend(m.ChannelID, "Disconnected.")
 	}
+}
 
-	// 3. UDP Hole Punching: Send silence frames to establish NAT traversal
-	silenceFrame := []byte{0xF8, 0xFF, 0xFE} // Opus silence frame
-	for i := 0; i < 5; i++ {
-		if b.VoiceConnection != nil {
-			b.VoiceConnection.OpusSend <- silenceFrame
+func (b *Bot) handleStatus(s *discordgo.Session, m *discordgo.MessageCreate) {
+	active := 0
+	for _, sess := range b.allSessions() {
+		if sess.active() {
+			active++
 		}
-		time.Sleep(20 * time.Millisecond)
 	}
 
-	// --- Start Subsystems ---
+	sess := b.lookupSession(m.GuildID)
+	if sess == nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Status: idle (not connected to voice). Active bridges: %d.", active))
+		return
+	}
+	st := sess.Status()
+
+	var sb strings.Builder
+	switch {
+	case st.Reconnecting:
+		fmt.Fprintf(&sb, "Status: reconnecting to <#%s>...\n", st.ChannelID)
+	case st.Connected:
+		fmt.Fprintf(&sb, "Status: connected to <#%s>\n", st.ChannelID)
+	default:
+		sb.WriteString("Status: idle (not connected to voice).\n")
+	}
+	if st.Connected {
+		fmt.Fprintf(&sb, "Ingress: %d kbps, FEC %t, expected loss %d%%\n", st.Ingress.Bitrate/1000, st.Ingress.FEC, st.Ingress.PacketLoss)
+		fmt.Fprintf(&sb, "Drops: %.1f%% (last window), %d dropped / %d sent, %d underruns\n",
+			st.Ingress.DropRate*100, st.Ingress.Dropped, st.Ingress.Sent, st.Ingress.Underruns)
+	}
+	if st.FollowUserID != "" {
+		fmt.Fprintf(&sb, "Following: <@%s>\n", st.FollowUserID)
+	}
+	fmt.Fprintf(&sb, "Active bridges: %d\n", active)
+	s.ChannelMessageSend(m.ChannelID, sb.String())
+}
 
-	// Start Egress Capture (Discord -> SRT)
-	go func() {
-		log.Println("[Bot] Starting packet capture loop.")
-		for p := range vc.OpusRecv {
-			if b.StreamManager != nil {
-				b.StreamManager.HandlePacket(p)
-			}
+func (b *Bot) handleDevices(s *discordgo.Session, m *discordgo.MessageCreate) {
+	devices, err := overlay.ListInputDevices(b.Config.Ingress)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if len(devices) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No capture devices found.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Capture devices (* = configured):\n")
+	for _, d := range devices {
+		marker := " "
+		if d.Selected {
+			marker = "*"
 		}
-		log.Println("[Bot] Packet capture loop terminated.")
-	}()
+		fmt.Fprintf(&sb, "%s %s (%d ch)\n", marker, d.Name, d.Channels)
+	}
+	s.ChannelMessageSend(m.ChannelID, sb.String())
+}
 
-	if b.StreamManager != nil {
-		if err := b.StreamManager.Start(); err != nil {
-			log.Printf("[Bot] Error starting StreamManager: %v", err)
+func (b *Bot) handleShutdown(s *discordgo.Session, m *discordgo.MessageCreate) {
+	s.ChannelMessageSend(m.ChannelID, "System shutting down...")
+	b.handleLeave(s, m)
+
+	// Send termination signal to main process to trigger graceful shutdown
+	if b.ShutdownChan != nil {
+		logger.Info("Sending shutdown signal...", "user", m.Author.ID)
+		b.ShutdownChan <- syscall.SIGTERM
+	}
+}
+
+// --- Media Playback ---
+
+func (b *Bot) handlePlay(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: play <file|url>")
+		return
+	}
+	source := strings.Join(args, " ")
+
+	// Local files are checked up front, URLs are validated by FFmpeg
+	if !strings.Contains(source, "://") {
+		if _, err := os.Stat(source); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Error: File not found.")
+			return
 		}
 	}
 
-	// Start Ingress Injection (Overlay -> Discord)
-	b.StopCaptureChan = make(chan struct{})
-	go func() {
-		if err := overlay.CaptureAndStream(vc, b.StopCaptureChan); err != nil {
-			log.Printf("[Bot] Error in Overlay capture: %v", err)
+	sess := b.session(m.GuildID)
+	sess.Player.Enqueue(source)
+	if !sess.active() {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Queued: %s (plays after join)", source))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Queued: %s", source))
+}
+
+func (b *Bot) handleSkip(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if sess := b.lookupSession(m.GuildID); sess != nil && sess.Player.Skip() {
+		s.ChannelMessageSend(m.ChannelID, "Skipped.")
+	} else {
+		s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
+	}
+}
+
+func (b *Bot) handleStop(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if sess := b.lookupSession(m.GuildID); sess != nil {
+		sess.Player.Stop()
+		sess.Soundboard.Silence()
+		sess.Announcer.Stop()
+	}
+	s.ChannelMessageSend(m.ChannelID, "Playback stopped, queue cleared.")
+}
+
+func (b *Bot) handleVolume(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	sess := b.lookupSession(m.GuildID)
+	if sess == nil {
+		s.ChannelMessageSend(m.ChannelID, "Error: No bridge or queue in this server.")
+		return
+	}
+	player := sess.Player
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Volume: %.0f%%", player.Volume()*100))
+		return
+	}
+
+	percent, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+	if err != nil || percent < 0 || percent > 200 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: volume <0-200>")
+		return
+	}
+	player.SetVolume(float32(percent) / 100)
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Volume set to %d%%.", percent))
+}
+
+func (b *Bot) handleQueue(s *discordgo.Session, m *discordgo.MessageCreate) {
+	var current string
+	var queue []string
+	if sess := b.lookupSession(m.GuildID); sess != nil {
+		current, queue = sess.Player.NowPlaying()
+	}
+	if current == "" && len(queue) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Queue is empty.")
+		return
+	}
+
+	var sb strings.Builder
+	if current != "" {
+		fmt.Fprintf(&sb, "Now playing: %s\n", current)
+	}
+	for i, item := range queue {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, item)
+	}
+	s.ChannelMessageSend(m.ChannelID, sb.String())
+}
+
+func (b *Bot) handleSfx(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		names := b.Soundboard.Names()
+		if len(names) == 0 {
+			s.ChannelMessageSend(m.ChannelID, "No soundboard clips loaded.")
+			return
 		}
-	}()
+		s.ChannelMessageSend(m.ChannelID, "Clips: "+strings.Join(names, ", "))
+		return
+	}
 
-	s.ChannelMessageSend(m.ChannelID, "Audio Bridge Active.")
+	sess, err := b.activeSession(m.GuildID)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if err := sess.Soundboard.Trigger(args[0]); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
+	}
 }
 
-func (b *Bot) handleLeave(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if b.VoiceConnection == nil {
+func (b *Bot) handleSay(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if b.TTS == nil {
+		s.ChannelMessageSend(m.ChannelID, "Error: TTS is not configured.")
+		return
+	}
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: say <text>")
 		return
 	}
 
-	// Stop Overlay Capture
-	if b.StopCaptureChan != nil {
-		close(b.StopCaptureChan)
-		b.StopCaptureChan = nil
+	text := strings.Join(args, " ")
+	maxLength := b.Config.TTS.MaxLength
+	if maxLength <= 0 {
+		maxLength = 300
 	}
-	// Stop SRT Stream
-	if b.StreamManager != nil {
-		b.StreamManager.Stop()
+	if utf8.RuneCountInString(text) > maxLength {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: Announcement too long (max %d characters).", maxLength))
+		return
 	}
 
-	// Disconnect Voice
-	b.VoiceConnection.Disconnect(context.Background())
-	b.VoiceConnection = nil
-	
-	s.ChannelMessageSend(m.ChannelID, "Disconnected.")
-	log.Println("[Bot] Voice connection closed.")
+	sess, err := b.activeSession(m.GuildID)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	// Synthesis may take a while, don't block the event handler
+	announcer := sess.Announcer
+	go func() {
+		pcm, err := b.TTS.Synthesize(text)
+		if err != nil {
+			logger.Error("TTS synthesis failed", "guild", m.GuildID, "user", m.Author.ID, "err", err)
+			s.ChannelMessageSend(m.ChannelID, "Error: TTS synthesis failed.")
+			return
+		}
+		announcer.EnqueuePCM("say: "+text, pcm)
+	}()
 }
 
-func (b *Bot) handleShutdown(s *discordgo.Session, m *discordgo.MessageCreate) {
-	s.ChannelMessageSend(m.ChannelID, "System shutting down...")
-	b.handleLeave(s, m)
+// Discord attachment limits for bots on servers without boosts
+const (
+	maxAttachments     = 10
+	maxAttachmentBytes = 10 << 20 // Per message
+	defaultClipSeconds = 30
+)
 
-	// Send termination signal to main process to trigger graceful shutdown
-	if b.ShutdownChan != nil {
-		log.Println("[Bot] Sending shutdown signal...")
-		b.ShutdownChan <- syscall.SIGTERM
+func (b *Bot) handleClip(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	seconds := defaultClipSeconds
+	if len(args) > 0 {
+		n, err := strconv.Atoi(strings.TrimSuffix(args[0], "s"))
+		if err != nil || n <= 0 {
+			s.ChannelMessageSend(m.ChannelID, "Usage: clip <seconds>")
+			return
+		}
+		seconds = n
 	}
+	// More than the buffer holds returns all of it
+	if sess := b.lookupSession(m.GuildID); sess != nil {
+		if limit := sess.StreamManager.ReplaySeconds(); limit > 0 && seconds > limit {
+			seconds = limit
+		}
+	}
+
+	// Encoding takes a moment, don't block the event handler
+	go func() {
+		clips, length, err := b.Clip(m.GuildID, seconds)
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		// The mix comes first; speaker tracks that don't fit the upload limits are left out
+		var files []*discordgo.File
+		size := 0
+		for _, c := range clips {
+			if len(files) == maxAttachments || size+len(c.Data) > maxAttachmentBytes {
+				break
+			}
+			files = append(files, &discordgo.File{Name: c.Name, ContentType: "audio/ogg", Reader: bytes.NewReader(c.Data)})
+			size += len(c.Data)
+		}
+		if len(files) == 0 {
+			s.ChannelMessageSend(m.ChannelID, "Error: Clip too large to upload, try fewer seconds.")
+			return
+		}
+		content := fmt.Sprintf("Replay: last %.0fs.", length.Seconds())
+		if omitted := len(clips) - len(files); omitted > 0 {
+			content += fmt.Sprintf(" %d speaker track(s) left out (upload limit).", omitted)
+		}
+		if _, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Content: content, Files: files}); err != nil {
+			logger.Error("Clip upload failed", "guild", m.GuildID, "err", err)
+			s.ChannelMessageSend(m.ChannelID, "Error: Clip upload failed.")
+			return
+		}
+		logger.Info("Replay clip uploaded", "guild", m.GuildID, "user", m.Author.ID, "seconds", length.Seconds(), "tracks", len(files), "bytes", size)
+	}()
 }
@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"VLX_AudioBridge/internal/stream"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Operations shared by chat commands and the HTTP control API.
+
+// validateVoiceChannel checks that channelID is a voice channel of guildID.
+// Channels missing from the state cache are left to the voice join to reject.
+func (b *Bot) validateVoiceChannel(guildID, channelID string) error {
+	ch, err := b.Session.State.Channel(channelID)
+	if err != nil {
+		return nil
+	}
+	if ch.GuildID != guildID || (ch.Type != discordgo.ChannelTypeGuildVoice && ch.Type != discordgo.ChannelTypeGuildStageVoice) {
+		return fmt.Errorf("not a voice channel of this server")
+	}
+	return nil
+}
+
+// Join starts (or moves) the bridge of a guild to a voice channel.
+func (b *Bot) Join(guildID, channelID string) error {
+	if err := b.validateVoiceChannel(guildID, channelID); err != nil {
+		return err
+	}
+	return b.startSession(guildID, channelID, "")
+}
+
+// startSession starts (or moves) a guild's bridge. A session left idle by a failed
+// start is dropped again, unless it holds media queued before the join.
+func (b *Bot) startSession(guildID, channelID, notifyChannelID string) error {
+	sess := b.session(guildID)
+	err := sess.Start(channelID, notifyChannelID)
+	if err != nil {
+		b.dropIdleSession(sess)
+	}
+	return err
+}
+
+// dropIdleSession removes a session that is not bridging, following or holding queued media.
+func (b *Bot) dropIdleSession(sess *GuildSession) {
+	if sess.active() || sess.followedUser() != "" || sess.autoJoinPending() {
+		return
+	}
+	if current, queue := sess.Player.NowPlaying(); current != "" || len(queue) > 0 {
+		return
+	}
+	b.removeSession(sess)
+}
+
+// Leave stops the bridge of a guild, ends follow mode and cancels a pending auto-join.
+// Returns false if none of them was active.
+func (b *Bot) Leave(guildID string) bool {
+	sess := b.lookupSession(guildID)
+	if sess == nil {
+		return false
+	}
+	sess.setFollow("", "")
+	cancelled := sess.cancelAutoJoin()
+	stopped := sess.Stop()
+	b.removeSession(sess)
+	return stopped || cancelled
+}
+
+// Sessions returns the status of every guild session.
+func (b *Bot) Sessions() []SessionStatus {
+	sessions := b.allSessions()
+	statuses := make([]SessionStatus, 0, len(sessions))
+	for _, sess := range sessions {
+		statuses = append(statuses, sess.Status())
+	}
+	return statuses
+}
+
+// activeSession returns the session of a guild, or an error if the bridge is not running.
+func (b *Bot) activeSession(guildID string) (*GuildSession, error) {
+	sess := b.lookupSession(guildID)
+	if sess == nil || !sess.active() {
+		return nil, fmt.Errorf("no active bridge in guild %s", guildID)
+	}
+	return sess, nil
+}
+
+// Users returns the per-user mix settings of a guild's stream.
+func (b *Bot) Users(guildID string) ([]stream.UserSettings, error) {
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return nil, err
+	}
+	return sess.StreamManager.Users(), nil
+}
+
+// SetUserVolume sets a user's gain in a guild's stream mix (1.0 = unity, max 2.0).
+func (b *Bot) SetUserVolume(guildID, userID string, volume float64) error {
+	if volume < 0 || volume > 2 {
+		return fmt.Errorf("volume must be between 0 and 2")
+	}
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return err
+	}
+	sess.StreamManager.SetUserVolume(userID, volume)
+	return nil
+}
+
+// SetUserMute removes a user from (or restores them to) a guild's stream mix.
+func (b *Bot) SetUserMute(guildID, userID string, muted bool) error {
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return err
+	}
+	sess.StreamManager.SetUserMute(userID, muted)
+	return nil
+}
+
+// StartOutput restarts the stream output of an active bridge after StopOutput.
+func (b *Bot) StartOutput(guildID string) error {
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return err
+	}
+	if sess.StreamManager.Running() {
+		return fmt.Errorf("output already running")
+	}
+	return sess.StreamManager.Start()
+}
+
+// StopOutput stops the stream output of a bridge while staying in voice.
+func (b *Bot) StopOutput(guildID string) error {
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return err
+	}
+	if !sess.StreamManager.Running() {
+		return fmt.Errorf("output not running")
+	}
+	sess.StreamManager.Stop()
+	return nil
+}
+
+// SetStreamTitle sets the show title sent as metadata by a bridge's outputs; "" restores the configured one.
+func (b *Bot) SetStreamTitle(guildID, title string) error {
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return err
+	}
+	sess.StreamManager.SetTitle(title)
+	return nil
+}
+
+// Clip encodes the last seconds of a bridge's replay buffer.
+func (b *Bot) Clip(guildID string, seconds int) ([]stream.Clip, time.Duration, error) {
+	sess, err := b.activeSession(guildID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sess.StreamManager.Clip(seconds)
+}
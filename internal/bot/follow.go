@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// setFollow makes the session follow a user's voice channel ("" disables follow mode).
+func (gs *GuildSession) setFollow(userID, notifyChannelID string) {
+	gs.mutex.Lock()
+	gs.followUserID = userID
+	if notifyChannelID != "" {
+		gs.notifyChannelID = notifyChannelID
+	}
+	gs.mutex.Unlock()
+}
+
+// followedUser returns the followed user ID, or "".
+func (gs *GuildSession) followedUser() string {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	return gs.followUserID
+}
+
+// followTo joins, moves or leaves so the bot sits in channelID ("" = followed user left voice).
+// Follow transitions are serialized so quick channel hopping ends in the latest channel.
+func (gs *GuildSession) followTo(channelID string) {
+	gs.followMutex.Lock()
+	defer gs.followMutex.Unlock()
+
+	gs.mutex.Lock()
+	current, notify, following := gs.channelID, gs.notifyChannelID, gs.followUserID != ""
+	gs.mutex.Unlock()
+
+	if !following || channelID == current {
+		return
+	}
+
+	if channelID == "" {
+		gs.log.Info("Followed user left voice, leaving.")
+		gs.Stop()
+		return
+	}
+
+	gs.log.Info("Following user", "channel", channelID)
+	if err := gs.Start(channelID, notify); err != nil {
+		gs.log.Error("Follow join failed", "channel", channelID, "err", err)
+		if notify != "" {
+			gs.bot.Session.ChannelMessageSend(notify, fmt.Sprintf("Error: Could not follow into <#%s>: %v", channelID, err))
+		}
+	}
+}
+
+// onFollowedVoiceState reacts to voice state changes of followed users.
+func (b *Bot) onFollowedVoiceState(v *discordgo.VoiceStateUpdate) {
+	sess := b.lookupSession(v.GuildID)
+	if sess == nil || sess.followedUser() != v.UserID {
+		return
+	}
+	// Joining waits for the voice handshake, don't block the event handler
+	go sess.followTo(v.ChannelID)
+}
+
+func (b *Bot) handleFollow(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: follow <@user|off>")
+		return
+	}
+
+	if args[0] == "off" {
+		if sess := b.lookupSession(m.GuildID); sess != nil {
+			sess.setFollow("", "")
+		}
+		s.ChannelMessageSend(m.ChannelID, "Follow mode disabled.")
+		return
+	}
+
+	userID := strings.Trim(args[0], "<@!>")
+	if len(m.Mentions) > 0 {
+		userID = m.Mentions[0].ID
+	}
+
+	sess := b.session(m.GuildID)
+	sess.setFollow(userID, m.ChannelID)
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Following <@%s>.", userID))
+
+	// Join right away if the user is already in voice
+	if vs, err := s.State.VoiceState(m.GuildID, userID); err == nil && vs.ChannelID != "" {
+		go sess.followTo(vs.ChannelID)
+	}
+}
@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"VLX_AudioBridge/internal/system"
+)
+
+// responsiveTimeout bounds how long the liveness check waits for the bot's locks.
+const responsiveTimeout = 5 * time.Second
+
+// HealthCheck is the result of one component check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthReport aggregates the component checks.
+// Live fails only when the process itself is stuck (its state can't be locked);
+// the gateway, the audio device and the outputs recover on their own and affect
+// Ready only, which also requires every active bridge to be connected and capturing.
+type HealthReport struct {
+	Live   bool          `json:"live"`
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+func (r *HealthReport) add(name string, ok, liveness bool, detail string) {
+	r.Checks = append(r.Checks, HealthCheck{Name: name, OK: ok, Detail: detail})
+	if !ok {
+		r.Ready = false
+		if liveness {
+			r.Live = false
+		}
+	}
+}
+
+// Health checks that the bot is responsive, then the Discord gateway, the audio device
+// and, for every active bridge, the voice connection, the FFmpeg output and the overlay capture.
+func (b *Bot) Health() HealthReport {
+	report := HealthReport{Live: true, Ready: true}
+
+	if !b.Responsive(responsiveTimeout) {
+		// The checks below take the same locks and would hang
+		report.add("responsive", false, true, "bot state locked for over "+responsiveTimeout.String())
+		return report
+	}
+	report.add("responsive", true, true, "")
+
+	b.Session.RLock()
+	gatewayReady := b.Session.DataReady
+	b.Session.RUnlock()
+	report.add("discord_gateway", gatewayReady, false, detailIf(!gatewayReady, "not connected"))
+
+	if err := system.SinkAvailable(); err != nil {
+		report.add("audio_device", false, false, err.Error())
+	} else {
+		report.add("audio_device", true, false, "")
+	}
+
+	for _, sess := range b.allSessions() {
+		sess.health(&report)
+	}
+	return report
+}
+
+// Live reports whether the bot is responsive, without the other checks of Health.
+func (b *Bot) Live() bool {
+	return b.Responsive(responsiveTimeout)
+}
+
+// Responsive reports whether the bot's shared state (sessions and the gateway
+// state) can be locked within timeout, i.e. event handling isn't deadlocked.
+// It runs no external commands, so the systemd watchdog can call it.
+// Only one probe runs at a time: while a probe is stuck on a lock, every call
+// waits for that same probe instead of leaving another goroutine behind.
+func (b *Bot) Responsive(timeout time.Duration) bool {
+	b.probeMutex.Lock()
+	done := b.probe
+	if done == nil {
+		done = make(chan struct{})
+		b.probe = done
+		go b.runProbe(done)
+	}
+	b.probeMutex.Unlock()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// runProbe takes and releases the locks Responsive checks, then closes done.
+func (b *Bot) runProbe(done chan struct{}) {
+	b.Session.RLock()
+	b.Session.RUnlock()
+	for _, sess := range b.allSessions() {
+		sess.mutex.Lock()
+		sess.mutex.Unlock()
+	}
+
+	b.probeMutex.Lock()
+	b.probe = nil
+	b.probeMutex.Unlock()
+	close(done)
+}
+
+// health adds the checks of an active session to the report.
+func (gs *GuildSession) health(report *HealthReport) {
+	gs.mutex.Lock()
+	vc := gs.voiceConnection
+	reconnecting := gs.reconnectCancel != nil
+	ingress := gs.ingress
+	captureErr := gs.captureErr
+	gs.mutex.Unlock()
+
+	if vc == nil && !reconnecting {
+		return
+	}
+
+	voiceReady := false
+	if vc != nil {
+		vc.RLock()
+		voiceReady = vc.Ready
+		vc.RUnlock()
+	}
+	detail := ""
+	switch {
+	case reconnecting:
+		detail = "reconnecting"
+	case !voiceReady:
+		detail = "not ready"
+	}
+	report.add("voice:"+gs.GuildID, voiceReady && !reconnecting, false, detail)
+
+	// An output stopped through the API is not a failure
+	if gs.StreamManager.Running() {
+		// Outputs restart themselves, so a dead destination affects readiness only
+		dead := gs.StreamManager.DeadOutputs()
+		report.add("output:"+gs.GuildID, len(dead) == 0, false, detailIf(len(dead) > 0, "down: "+strings.Join(dead, ", ")))
+	}
+
+	if vc != nil {
+		switch {
+		case captureErr != nil:
+			report.add("capture:"+gs.GuildID, false, false, captureErr.Error())
+		case ingress == nil || !ingress.Capturing():
+			report.add("capture:"+gs.GuildID, false, false, "capture device not open")
+		default:
+			report.add("capture:"+gs.GuildID, true, false, "")
+		}
+	}
+}
+
+func detailIf(cond bool, detail string) string {
+	if cond {
+		return detail
+	}
+	return ""
+}
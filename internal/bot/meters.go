@@ -0,0 +1,63 @@
+package bot
+
+import "VLX_AudioBridge/internal/stream"
+
+// GuildMeters is the live dashboard view of one guild bridge.
+type GuildMeters struct {
+	GuildID       string `json:"guild_id"`
+	ChannelID     string `json:"channel_id"`
+	Connected     bool   `json:"connected"`
+	Reconnecting  bool   `json:"reconnecting"`
+	OutputRunning bool   `json:"output_running"`
+	stream.Levels
+	Overlay stream.Level `json:"overlay"` // Overlay -> Discord audio
+}
+
+// Meters returns the live levels and state of every guild session.
+func (b *Bot) Meters() []GuildMeters {
+	sessions := b.allSessions()
+	meters := make([]GuildMeters, 0, len(sessions))
+	for _, sess := range sessions {
+		st := sess.Status()
+		gm := GuildMeters{
+			GuildID:       st.GuildID,
+			ChannelID:     st.ChannelID,
+			Connected:     st.Connected,
+			Reconnecting:  st.Reconnecting,
+			OutputRunning: st.OutputRunning,
+			Levels:        sess.StreamManager.Levels(),
+		}
+		for i := range gm.Users {
+			gm.Users[i].Name = b.displayName(sess.GuildID, gm.Users[i].UserID)
+		}
+
+		sess.mutex.Lock()
+		ingress := sess.ingress
+		sess.mutex.Unlock()
+		if ingress != nil {
+			gm.Overlay.PeakDB, gm.Overlay.RMSDB = ingress.Level()
+		} else {
+			gm.Overlay = stream.SilentLevel
+		}
+		meters = append(meters, gm)
+	}
+	return meters
+}
+
+// displayName resolves a user's nickname or username from the state cache.
+func (b *Bot) displayName(guildID, userID string) string {
+	if userID == "" {
+		return ""
+	}
+	member, err := b.Session.State.Member(guildID, userID)
+	if err != nil || member.User == nil {
+		return ""
+	}
+	if member.Nick != "" {
+		return member.Nick
+	}
+	if member.User.GlobalName != "" {
+		return member.User.GlobalName
+	}
+	return member.User.Username
+}
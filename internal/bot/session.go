@@ -0,0 +1,521 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
+	"VLX_AudioBridge/internal/metrics"
+	"VLX_AudioBridge/internal/overlay"
+	"VLX_AudioBridge/internal/stream"
+	"github.com/bwmarrin/discordgo"
+)
+
+const maxReconnectBackoff = 60 * time.Second
+
+// GuildSession is the bridge of a single guild. It owns the voice connection, the
+// stream.Manager (mixer and outputs), the media players and the overlay capture, so
+// several guilds can be bridged concurrently by the same bot.
+type GuildSession struct {
+	bot           *Bot
+	log           *slog.Logger // Bot logger with the guild field
+	GuildID       string
+	StreamManager *stream.Manager
+	Player        *overlay.Player
+	Announcer     *overlay.Player // Separate queue so announcements don't wait behind music
+	Soundboard    *overlay.Soundboard
+
+	// Voice state, guarded by mutex (event handlers run concurrently)
+	mutex           sync.Mutex
+	voiceConnection *discordgo.VoiceConnection
+	stopCaptureChan chan struct{}
+	ingress         *overlay.Ingress
+	captureErr      error // Why the overlay capture of the current connection stopped
+	channelID       string
+	notifyChannelID string        // Text channel for reconnection notices
+	reconnectCancel chan struct{} // Non-nil while reconnecting
+	autoJoinCancel  chan struct{} // Non-nil while the auto-join loop retries
+	followUserID    string        // Follow mode target, "" if disabled
+
+	startMutex  sync.Mutex // Serializes Start and Stop (chat, API, follow and auto-join)
+	followMutex sync.Mutex // Serializes follow mode joins/moves
+}
+
+// SessionStatus is a snapshot of a guild session.
+type SessionStatus struct {
+	GuildID       string               `json:"guild_id"`
+	ChannelID     string               `json:"channel_id"`
+	Connected     bool                 `json:"connected"`
+	Reconnecting  bool                 `json:"reconnecting"`
+	Destinations  []string             `json:"destinations"`
+	OutputRunning bool                 `json:"output_running"`
+	Title         string               `json:"title,omitempty"` // Show title set through the API
+	FollowUserID  string               `json:"follow_user_id,omitempty"`
+	Ingress       overlay.IngressStats `json:"ingress"`
+}
+
+func (b *Bot) newGuildSession(guildID string) *GuildSession {
+	sm := stream.NewManager(guildID, b.Config.Streaming.ForGuild(guildID))
+	sm.SetNameResolver(func(userID string) string { return b.displayName(guildID, userID) })
+	soundboard := b.Soundboard.Clone()
+	if b.Config.Soundboard.IncludeInStream {
+		soundboard.StreamTap = sm.InjectFrame
+	}
+	return &GuildSession{
+		bot:           b,
+		log:           logging.For(logging.Bot).With("guild", guildID),
+		GuildID:       guildID,
+		StreamManager: sm,
+		Player:        overlay.NewPlayer(),
+		Announcer:     overlay.NewPlayer(),
+		Soundboard:    soundboard,
+	}
+}
+
+// session returns the session of a guild, creating an idle one if needed. Only
+// joins and commands that work before a join (play, follow) create sessions.
+func (b *Bot) session(guildID string) *GuildSession {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	sess, ok := b.sessions[guildID]
+	if !ok {
+		sess = b.newGuildSession(guildID)
+		b.sessions[guildID] = sess
+	}
+	return sess
+}
+
+// lookupSession returns the session of a guild, or nil.
+func (b *Bot) lookupSession(guildID string) *GuildSession {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.sessions[guildID]
+}
+
+// allSessions returns a snapshot of every session.
+func (b *Bot) allSessions() []*GuildSession {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	sessions := make([]*GuildSession, 0, len(b.sessions))
+	for _, sess := range b.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// claimDestinations reserves a guild's output destinations for its bridge. Two bridges
+// publishing to the same destination would fight over the stream (SRT stream ID,
+// Icecast mount, HLS directory), so one used by another guild is refused.
+func (b *Bot) claimDestinations(guildID string) error {
+	destinations := outputURLs(b.Config.Streaming.ForGuild(guildID))
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, d := range destinations {
+		if owner, ok := b.destinations[d]; ok && owner != guildID {
+			return fmt.Errorf("destination %s is already used by the bridge of guild %s; give each guild its own in streaming.guilds", d, owner)
+		}
+	}
+	for _, d := range destinations {
+		b.destinations[d] = guildID
+	}
+	return nil
+}
+
+// releaseDestinations frees the destinations claimed by a guild's bridge.
+func (b *Bot) releaseDestinations(guildID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for d, owner := range b.destinations {
+		if owner == guildID {
+			delete(b.destinations, d)
+		}
+	}
+}
+
+// removeSession drops an idle session.
+func (b *Bot) removeSession(sess *GuildSession) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.sessions[sess.GuildID] == sess {
+		delete(b.sessions, sess.GuildID)
+		metrics.ForgetGuild(sess.GuildID)
+	}
+}
+
+// Status returns a snapshot of the session state.
+func (gs *GuildSession) Status() SessionStatus {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	st := SessionStatus{
+		GuildID:       gs.GuildID,
+		ChannelID:     gs.channelID,
+		Connected:     gs.voiceConnection != nil,
+		Reconnecting:  gs.reconnectCancel != nil,
+		Destinations:  outputURLs(gs.bot.Config.Streaming.ForGuild(gs.GuildID)),
+		OutputRunning: gs.StreamManager.Running(),
+		Title:         gs.StreamManager.Title(),
+		FollowUserID:  gs.followUserID,
+	}
+	if gs.ingress != nil {
+		st.Ingress = gs.ingress.Stats()
+	}
+	return st
+}
+
+// outputURLs lists the destinations a guild's bridge publishes to.
+func outputURLs(cfg config.StreamingConfig) []string {
+	var urls []string
+	for _, o := range cfg.OutputList() {
+		switch o.Type {
+		case config.OutputIcecast:
+			urls = append(urls, o.URL+o.Mount)
+		case config.OutputHLS:
+			urls = append(urls, o.Directory)
+		default:
+			urls = append(urls, o.URL)
+		}
+	}
+	return urls
+}
+
+// active reports whether the session is connected or reconnecting.
+func (gs *GuildSession) active() bool {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	return gs.voiceConnection != nil || gs.reconnectCancel != nil
+}
+
+// Start joins the voice channel and starts the egress (Discord -> SRT) and
+// ingress (Overlay -> Discord) pipelines. notifyChannelID receives reconnection notices.
+func (gs *GuildSession) Start(channelID, notifyChannelID string) error {
+	gs.startMutex.Lock()
+	defer gs.startMutex.Unlock()
+	b := gs.bot
+	if !b.guildAllowed(gs.GuildID) {
+		return permanent(fmt.Errorf("guild %s is not allowed by config", gs.GuildID))
+	}
+
+	if err := b.checkVoiceAccess(gs.GuildID, channelID); err != nil {
+		return err
+	}
+
+	// Refuse up front when the capture device is missing, instead of reporting the
+	// bridge as active while the overlay capture fails in the background
+	if _, err := overlay.CheckInputDevice(b.Config.Ingress); err != nil {
+		return permanent(fmt.Errorf("overlay capture: %w", err))
+	}
+
+	// Before tearing anything down, so a refused move keeps the current bridge
+	if err := b.claimDestinations(gs.GuildID); err != nil {
+		return err
+	}
+
+	// Switching channel: tear down the current bridge first
+	gs.stop()
+
+	// Record the target before joining so our own voice state update isn't seen as a move
+	gs.mutex.Lock()
+	gs.channelID, gs.notifyChannelID = channelID, notifyChannelID
+	gs.mutex.Unlock()
+
+	// Join Voice Channel and wait for the UDP handshake (context required by ozraru fork)
+	timeout := b.voiceReadyTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	vc, err := b.joinVoice(ctx, gs.GuildID, channelID)
+	if err != nil {
+		gs.mutex.Lock()
+		gs.channelID = ""
+		gs.mutex.Unlock()
+		b.releaseDestinations(gs.GuildID)
+		if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return fmt.Errorf("voice connection did not become ready within %s", timeout)
+		}
+		return err
+	}
+
+	// Mix for the meters and the replay buffer even without outputs, then start SRT Stream
+	gs.StreamManager.Open()
+	if err := gs.StreamManager.Start(); err != nil {
+		gs.log.Error("Error starting StreamManager", "err", err)
+	}
+
+	gs.mutex.Lock()
+	gs.voiceConnection = vc
+	gs.attachVoiceLocked(vc)
+	gs.mutex.Unlock()
+	return nil
+}
+
+// Stop stops all pipelines, cancels a pending reconnection, leaves voice and frees
+// the output destinations. Returns false if the session was not active.
+func (gs *GuildSession) Stop() bool {
+	gs.startMutex.Lock()
+	defer gs.startMutex.Unlock()
+	stopped := gs.stop()
+	gs.bot.releaseDestinations(gs.GuildID)
+	return stopped
+}
+
+// stop tears the bridge down, keeping the destinations claimed. Caller must hold gs.startMutex.
+func (gs *GuildSession) stop() bool {
+	gs.mutex.Lock()
+	reconnecting := gs.reconnectCancel != nil
+	if reconnecting {
+		close(gs.reconnectCancel)
+		gs.reconnectCancel = nil
+	}
+	detached := gs.detachVoiceLocked()
+	vc := gs.voiceConnection
+	gs.voiceConnection = nil
+	gs.channelID = ""
+	gs.mutex.Unlock()
+
+	if vc == nil && !reconnecting {
+		return false
+	}
+
+	// Stop Media Playback
+	gs.Player.Stop()
+	gs.Soundboard.Silence()
+	gs.Announcer.Stop()
+
+	// Stop SRT Stream and mixing
+	gs.StreamManager.Close()
+
+	if vc != nil {
+		if detached {
+			// Allow time for capture goroutines to release the speaking flag
+			time.Sleep(100 * time.Millisecond)
+		}
+		// Context is required by the ozraru fork
+		vc.Disconnect(context.Background())
+	}
+	gs.log.Info("Voice connection closed.")
+	return true
+}
+
+// attachVoiceLocked starts the egress capture and overlay ingress loops on vc,
+// stopping any still running. Caller must hold gs.mutex.
+func (gs *GuildSession) attachVoiceLocked(vc *discordgo.VoiceConnection) {
+	gs.detachVoiceLocked()
+	stop := make(chan struct{})
+	gs.stopCaptureChan = stop
+
+	// Speaking updates map SSRCs to users for per-user volume and mute
+	vc.AddHandler(func(_ *discordgo.VoiceConnection, vs *discordgo.VoiceSpeakingUpdate) {
+		gs.StreamManager.SetUserSSRC(uint32(vs.SSRC), vs.UserID)
+	})
+
+	// Start Egress Capture (Discord -> SRT)
+	go gs.captureLoop(vc, stop)
+
+	// Start Ingress Injection (Overlay -> Discord)
+	ingress := overlay.NewIngress(gs.GuildID, gs.bot.Config.Ingress, gs.bot.channelBitrate(vc.ChannelID), gs.Player, gs.Soundboard, gs.Announcer)
+	gs.ingress = ingress
+	gs.captureErr = nil
+	go func() {
+		if err := ingress.CaptureAndStream(vc, stop); err != nil {
+			gs.log.Error("Error in Overlay capture", "channel", vc.ChannelID, "err", err)
+			gs.mutex.Lock()
+			if gs.ingress == ingress {
+				gs.captureErr = err
+			}
+			gs.mutex.Unlock()
+		}
+	}()
+}
+
+// detachVoiceLocked stops the loops started by attachVoiceLocked. Caller must hold gs.mutex.
+func (gs *GuildSession) detachVoiceLocked() bool {
+	if gs.stopCaptureChan == nil {
+		return false
+	}
+	close(gs.stopCaptureChan)
+	gs.stopCaptureChan = nil
+	return true
+}
+
+// captureLoop forwards received Opus packets to the stream manager and watches the
+// connection: a closed receive channel or a connection stuck not-ready counts as lost.
+func (gs *GuildSession) captureLoop(vc *discordgo.VoiceConnection, stop <-chan struct{}) {
+	gs.log.Info("Starting packet capture loop", "channel", vc.ChannelID)
+	defer gs.log.Info("Packet capture loop terminated", "channel", vc.ChannelID)
+
+	health := time.NewTicker(time.Second)
+	defer health.Stop()
+	var notReadySince time.Time
+	attached, received := time.Now(), false
+
+	for {
+		select {
+		case <-stop:
+			return
+		case p, ok := <-vc.OpusRecv:
+			if !ok {
+				go gs.handleVoiceLost(vc, "receive channel closed")
+				return
+			}
+			if !received {
+				received = true
+				gs.log.Info("First voice packet received", "channel", vc.ChannelID, "after", time.Since(attached).Round(time.Millisecond))
+			}
+			gs.StreamManager.HandlePacket(p)
+		case <-health.C:
+			vc.RLock()
+			ready := vc.Ready
+			vc.RUnlock()
+			if ready {
+				notReadySince = time.Time{}
+			} else if notReadySince.IsZero() {
+				notReadySince = time.Now()
+			} else if time.Since(notReadySince) > gs.bot.voiceReadyTimeout() {
+				go gs.handleVoiceLost(vc, "voice connection not ready")
+				return
+			}
+		}
+	}
+}
+
+// handleVoiceLost detaches the pipelines from a dead connection and starts reconnecting.
+// The SRT stream keeps running (mixing silence) so downstream players don't notice.
+func (gs *GuildSession) handleVoiceLost(vc *discordgo.VoiceConnection, reason string) {
+	gs.mutex.Lock()
+	if gs.voiceConnection != vc {
+		// Already replaced or left
+		gs.mutex.Unlock()
+		return
+	}
+	gs.detachVoiceLocked()
+	gs.voiceConnection = nil
+	cancel := make(chan struct{})
+	gs.reconnectCancel = cancel
+	notify := gs.notifyChannelID
+	gs.mutex.Unlock()
+
+	gs.log.Warn("Voice connection lost, reconnecting...", "channel", vc.ChannelID, "reason", reason)
+	if notify != "" {
+		gs.bot.Session.ChannelMessageSend(notify, "Voice connection lost, reconnecting...")
+	}
+
+	// Clean up discordgo's state for the dead connection
+	vc.Disconnect(context.Background())
+
+	go gs.reconnectLoop(notify, cancel)
+}
+
+// reconnectLoop rejoins the bridge channel with exponential backoff until it succeeds,
+// is cancelled by leave, or runs out of attempts.
+func (gs *GuildSession) reconnectLoop(notify string, cancel chan struct{}) {
+	b := gs.bot
+	backoff := time.Second
+	maxAttempts := b.Config.Discord.ReconnectMaxAttempts
+
+	for attempt := 1; maxAttempts <= 0 || attempt <= maxAttempts; attempt++ {
+		// Channel may have changed if the bot was moved
+		gs.mutex.Lock()
+		channelID := gs.channelID
+		gs.mutex.Unlock()
+
+		ctx, cancelCtx := context.WithTimeout(context.Background(), b.voiceReadyTimeout())
+		vc, err := b.joinVoice(ctx, gs.GuildID, channelID)
+		cancelCtx()
+
+		if err == nil {
+			gs.mutex.Lock()
+			select {
+			case <-cancel:
+				// Left while we were joining
+				gs.mutex.Unlock()
+				vc.Disconnect(context.Background())
+				return
+			default:
+			}
+			gs.reconnectCancel = nil
+			gs.voiceConnection = vc
+			gs.attachVoiceLocked(vc)
+			gs.mutex.Unlock()
+
+			gs.log.Info("Voice reconnected", "channel", channelID, "attempts", attempt)
+			if notify != "" {
+				b.Session.ChannelMessageSend(notify, "Voice reconnected. Audio Bridge Active.")
+			}
+			return
+		}
+
+		gs.log.Warn("Reconnect attempt failed", "channel", channelID, "attempt", attempt, "retry_in", backoff, "err", err)
+		select {
+		case <-cancel:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+
+	gs.log.Error("Giving up voice reconnection", "attempts", maxAttempts)
+	if notify != "" {
+		b.Session.ChannelMessageSend(notify, "Error: Voice reconnection failed, bridge stopped.")
+	}
+	// Same as leave: the session goes away with its buffers
+	gs.setFollow("", "")
+	gs.Stop()
+	b.removeSession(gs)
+}
+
+// onVoiceState detects the bot being disconnected or moved by Discord or a moderator.
+func (gs *GuildSession) onVoiceState(v *discordgo.VoiceStateUpdate) {
+	gs.mutex.Lock()
+	vc := gs.voiceConnection
+	if vc == nil {
+		gs.mutex.Unlock()
+		return
+	}
+
+	switch {
+	case v.ChannelID == "":
+		gs.mutex.Unlock()
+		gs.handleVoiceLost(vc, "disconnected from voice")
+	case v.ChannelID != gs.channelID:
+		gs.log.Info("Moved to another channel", "from", gs.channelID, "channel", v.ChannelID)
+		gs.channelID = v.ChannelID
+		gs.mutex.Unlock()
+		gs.handleVoiceLost(vc, "moved to another channel")
+	default:
+		gs.mutex.Unlock()
+	}
+}
+
+// onVoiceStateUpdate routes the bot's own voice state changes to the guild session,
+// and other users' changes to follow mode.
+func (b *Bot) onVoiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if s.State.User == nil {
+		return
+	}
+	if v.UserID != s.State.User.ID {
+		b.onFollowedVoiceState(v)
+		return
+	}
+	if sess := b.lookupSession(v.GuildID); sess != nil {
+		sess.onVoiceState(v)
+	}
+}
+
+// channelBitrate returns the voice channel bitrate (encoder cap), 0 if unknown.
+func (b *Bot) channelBitrate(channelID string) int {
+	if ch, err := b.Session.State.Channel(channelID); err == nil {
+		return ch.Bitrate
+	}
+	if ch, err := b.Session.Channel(channelID); err == nil {
+		return ch.Bitrate
+	}
+	return 0
+}
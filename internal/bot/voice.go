@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Default time allowed for the voice websocket and UDP handshake.
+const defaultVoiceReadyTimeout = 10 * time.Second
+
+// voiceReadyTimeout returns the configured voice readiness timeout.
+func (b *Bot) voiceReadyTimeout() time.Duration {
+	if b.Config.Discord.VoiceReadyTimeout > 0 {
+		return time.Duration(b.Config.Discord.VoiceReadyTimeout) * time.Second
+	}
+	return defaultVoiceReadyTimeout
+}
+
+// permanentError marks a join error that retrying won't fix (configuration,
+// permissions, missing capture device), so retry loops give up on it.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// isPermanent reports whether err is marked as not worth retrying.
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// checkVoiceAccess catches join failures Discord doesn't report (the join just never
+// completes), so they aren't mistaken for a voice timeout. Missing state is left to the join.
+func (b *Bot) checkVoiceAccess(guildID, channelID string) error {
+	if err := b.validateVoiceChannel(guildID, channelID); err != nil {
+		return permanent(err)
+	}
+	state := b.Session.State
+	if state.User == nil {
+		return nil
+	}
+	ch, err := state.Channel(channelID)
+	if err != nil {
+		return nil
+	}
+
+	perms, err := state.UserChannelPermissions(state.User.ID, channelID)
+	if err == nil {
+		if perms&discordgo.PermissionVoiceConnect == 0 {
+			return permanent(fmt.Errorf("missing Connect permission in voice channel %s", ch.Name))
+		}
+		if perms&discordgo.PermissionVoiceSpeak == 0 {
+			return permanent(fmt.Errorf("missing Speak permission in voice channel %s", ch.Name))
+		}
+	}
+
+	// Move Members lets the bot join full channels
+	if ch.UserLimit > 0 && (err != nil || perms&discordgo.PermissionVoiceMoveMembers == 0) {
+		guild, err := state.Guild(guildID)
+		if err != nil {
+			return nil
+		}
+		state.RLock()
+		members := 0
+		for _, vs := range guild.VoiceStates {
+			if vs.ChannelID == channelID && vs.UserID != state.User.ID {
+				members++
+			}
+		}
+		state.RUnlock()
+		if members >= ch.UserLimit {
+			return fmt.Errorf("voice channel %s is full (%d/%d)", ch.Name, members, ch.UserLimit)
+		}
+	}
+	return nil
+}
+
+// joinVoice joins the channel and blocks until the voice UDP path is up (or ctx expires).
+// On failure the half-open connection is torn down.
+func (b *Bot) joinVoice(ctx context.Context, guildID, channelID string) (*discordgo.VoiceConnection, error) {
+	vc, err := b.Session.ChannelVoiceJoin(ctx, guildID, channelID, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("voice join failed: %w", err)
+	}
+
+	if err := waitVoiceReady(ctx, vc); err != nil {
+		vc.Disconnect(context.Background())
+		return nil, err
+	}
+	return vc, nil
+}
+
+// waitVoiceReady waits for discordgo to flag the connection Ready, which happens once the
+// UDP IP discovery handshake has completed and the session description was received.
+// The discovery reply is the first UDP packet from the voice server, so a ready
+// connection has a working UDP path; incoming audio can't be awaited, a silent channel sends none.
+func waitVoiceReady(ctx context.Context, vc *discordgo.VoiceConnection) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		vc.RLock()
+		ready := vc.Ready
+		vc.RUnlock()
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("voice UDP path not ready: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
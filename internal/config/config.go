@@ -2,32 +2,377 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the structure of AudioBridge.yaml
 type Config struct {
-	Discord   DiscordConfig   `yaml:"discord"`
-	Streaming StreamingConfig `yaml:"streaming"`
-	Overlays  OverlaysConfig  `yaml:"overlays"`
+	Discord     DiscordConfig     `yaml:"discord"`
+	Streaming   StreamingConfig   `yaml:"streaming"`
+	Overlays    OverlaysConfig    `yaml:"overlays"`
+	Soundboard  SoundboardConfig  `yaml:"soundboard"`
+	TTS         TTSConfig         `yaml:"tts"`
+	Ingress     IngressConfig     `yaml:"ingress"`
+	Permissions PermissionsConfig `yaml:"permissions"`
+	HTTP        HTTPConfig        `yaml:"http"`
+	Logging     LoggingConfig     `yaml:"logging"`
+}
+
+// LoggingConfig controls the structured logger.
+type LoggingConfig struct {
+	Format string            `yaml:"format"` // text (default) or json
+	Level  string            `yaml:"level"`  // debug, info (default), warn or error
+	Levels map[string]string `yaml:"levels"` // Per-subsystem overrides (bot, audit, stream, overlay, capture, player, api, system, discord)
+}
+
+// HTTPConfig enables the local control API used by stream decks and automation.
+type HTTPConfig struct {
+	Bind  string `yaml:"bind"`  // Listen address, e.g. "127.0.0.1:8080"; empty disables the API
+	Token string `yaml:"token"` // Required bearer token
+}
+
+// PermissionsConfig controls who may run bot commands. The application owner is always allowed.
+type PermissionsConfig struct {
+	Default  PermissionRule            `yaml:"default"`  // Applies to commands without their own rule
+	Commands map[string]PermissionRule `yaml:"commands"` // Keyed by command name (join, leave, sfx, ...)
+}
+
+// PermissionRule allows listed Discord user IDs and members holding any listed role ID.
+type PermissionRule struct {
+	Users []string `yaml:"users"`
+	Roles []string `yaml:"roles"`
 }
 
 type DiscordConfig struct {
-	Token   string `yaml:"token"`
-	Prefix  string `yaml:"prefix"`
-	GuildID string `yaml:"guild_id"`
+	Token                string           `yaml:"token"`
+	Prefix               string           `yaml:"prefix"`
+	GuildID              string           `yaml:"guild_id"`               // Restrict commands and voice joins to this guild
+	AllowedGuilds        []string         `yaml:"allowed_guilds"`         // Additional allowed guilds
+	AllowedChannels      []string         `yaml:"allowed_channels"`       // Text channels accepting commands (empty = any)
+	VoiceReadyTimeout    int              `yaml:"voice_ready_timeout"`    // Seconds to wait for the voice UDP path, 0 means 10
+	ReconnectMaxAttempts int              `yaml:"reconnect_max_attempts"` // Voice reconnection attempts, 0 means unlimited
+	AutoJoin             []AutoJoinConfig `yaml:"auto_join"`              // Bridges started when the bot connects
+}
+
+// guildAllowed reports whether guild_id/allowed_guilds admit guildID (none set admits every guild).
+func (d DiscordConfig) guildAllowed(guildID string) bool {
+	if d.GuildID == "" && len(d.AllowedGuilds) == 0 {
+		return true
+	}
+	if d.GuildID == guildID {
+		return true
+	}
+	for _, id := range d.AllowedGuilds {
+		if id == guildID {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoJoinConfig is a voice channel joined (and streamed) automatically on startup.
+type AutoJoinConfig struct {
+	GuildID         string `yaml:"guild_id"`
+	ChannelID       string `yaml:"channel_id"`        // Voice channel
+	NotifyChannelID string `yaml:"notify_channel_id"` // Optional text channel for status notices
 }
 
 type StreamingConfig struct {
-	DestinationURL string   `yaml:"destination_url"`
-	Bitrate        string   `yaml:"bitrate"`
-	ExcludedUsers  []string `yaml:"excluded_users"`
+	DestinationURL string                          `yaml:"destination_url"` // Single SRT output, used when outputs is empty
+	Bitrate        string                          `yaml:"bitrate"`
+	ExcludedUsers  []string                        `yaml:"excluded_users"`
+	Outputs        []OutputConfig                  `yaml:"outputs"`
+	Replay         ReplayConfig                    `yaml:"replay"`
+	Guilds         map[string]GuildStreamingConfig `yaml:"guilds"` // Per-guild overrides, keyed by guild ID
+}
+
+// ReplayConfig sizes the in-memory buffer of the mix used by the "clip" command.
+type ReplayConfig struct {
+	Minutes int  `yaml:"minutes"`  // Buffer length, 0 means 2, -1 disables (about 11.5 MB per minute and track)
+	PerUser bool `yaml:"per_user"` // Also keep every speaker's own track, attached next to the mix
+}
+
+// GuildStreamingConfig overrides the stream settings of one guild's bridge.
+type GuildStreamingConfig struct {
+	DestinationURL string         `yaml:"destination_url"`
+	Bitrate        string         `yaml:"bitrate"`
+	Outputs        []OutputConfig `yaml:"outputs"`
+}
+
+// Stream output types
+const (
+	OutputSRT     = "srt"     // Opus in MPEG-TS published to the URL
+	OutputWHIP    = "whip"    // Pure-Go WebRTC publish to a WHIP endpoint
+	OutputIcecast = "icecast" // Icecast source (Ogg/Opus, or MP3 through FFmpeg)
+	OutputHLS     = "hls"     // Rolling HLS segments and playlist written to a directory
+)
+
+// SRT output engines
+const (
+	EngineNative = "native" // In-process Opus encode, TS mux and SRT (caller mode only)
+	EngineFFmpeg = "ffmpeg" // External FFmpeg process, any URL FFmpeg can write to
+)
+
+// Icecast formats, source protocols and metadata modes
+const (
+	FormatOpus = "opus" // Ogg/Opus, encoded in-process
+	FormatMP3  = "mp3"  // MP3, encoded by FFmpeg
+
+	ProtocolPUT    = "put"    // HTTP PUT (Icecast 2.4+)
+	ProtocolSOURCE = "source" // Legacy SOURCE method (older Icecast and compatible servers)
+
+	MetadataSpeaker = "speaker" // Loudest current speaker, falling back to the title
+	MetadataTitle   = "title"   // Show title
+)
+
+// OutputConfig is one destination of the mixed stream. Every output receives the same mix.
+type OutputConfig struct {
+	Type       string   `yaml:"type"`        // srt (default), whip, icecast or hls
+	Engine     string   `yaml:"engine"`      // srt: native or ffmpeg, empty picks native when the URL allows it
+	URL        string   `yaml:"url"`         // srt:// (or any FFmpeg output URL), the WHIP endpoint, or the Icecast server
+	Bitrate    string   `yaml:"bitrate"`     // e.g. "128k", defaults to streaming.bitrate
+	Token      string   `yaml:"token"`       // whip: optional bearer token
+	ICEServers []string `yaml:"ice_servers"` // whip: STUN/TURN URLs, none needed on a LAN
+
+	Mount       string `yaml:"mount"`       // icecast: mount point, e.g. "/vlx.opus"; hls: served at /hls/<mount>/ by the HTTP API
+	Username    string `yaml:"username"`    // icecast: source user, defaults to "source"
+	Password    string `yaml:"password"`    // icecast: source password
+	Format      string `yaml:"format"`      // icecast: opus (default) or mp3
+	Protocol    string `yaml:"protocol"`    // icecast: put (default) or source
+	StreamName  string `yaml:"stream_name"` // icecast: station name shown in directories and players
+	Description string `yaml:"description"` // icecast: station description
+	Public      bool   `yaml:"public"`      // icecast: list in public directories
+
+	Metadata string `yaml:"metadata"` // icecast: speaker or title, empty sends none
+	Title    string `yaml:"title"`    // icecast: show title, can be changed at runtime via the API
+
+	Directory      string `yaml:"directory"`       // hls: where segments and index.m3u8 are written
+	SegmentSeconds int    `yaml:"segment_seconds"` // hls: segment length, 0 means 4
+	Window         int    `yaml:"window"`          // hls: segments listed in the live playlist, 0 means 6
+	Archive        bool   `yaml:"archive"`         // hls: keep every segment (EVENT playlist) instead of a rolling window
+}
+
+// OutputList returns the configured outputs, or the single destination_url output.
+func (s StreamingConfig) OutputList() []OutputConfig {
+	if len(s.Outputs) == 0 {
+		if s.DestinationURL == "" {
+			return nil
+		}
+		return []OutputConfig{{Type: OutputSRT, URL: s.DestinationURL, Bitrate: s.Bitrate}}
+	}
+	outputs := make([]OutputConfig, len(s.Outputs))
+	for i, o := range s.Outputs {
+		if o.Type == "" {
+			o.Type = OutputSRT
+		}
+		if o.Bitrate == "" {
+			o.Bitrate = s.Bitrate
+		}
+		outputs[i] = o
+	}
+	return outputs
+}
+
+// ForGuild returns the streaming config with the guild's overrides applied.
+func (s StreamingConfig) ForGuild(guildID string) StreamingConfig {
+	cfg := s
+	cfg.Guilds = nil
+	if g, ok := s.Guilds[guildID]; ok {
+		if g.DestinationURL != "" {
+			// A guild destination replaces the shared outputs
+			cfg.DestinationURL = g.DestinationURL
+			cfg.Outputs = nil
+		}
+		if len(g.Outputs) > 0 {
+			cfg.Outputs = g.Outputs
+		}
+		if g.Bitrate != "" {
+			cfg.Bitrate = g.Bitrate
+		}
+	}
+	return cfg
 }
 
 type OverlaysConfig struct {
-	URLs []string `yaml:"urls"`
+	URLs     []string        `yaml:"urls"`
+	Browsers []OverlayConfig `yaml:"browsers"`
+}
+
+// OverlayConfig describes a single overlay browser.
+// UserDataDir keeps the Chromium profile across restarts, Headers and CookiesFile
+// are injected through DevTools before the overlay URL is loaded.
+type OverlayConfig struct {
+	URL         string            `yaml:"url"`
+	UserDataDir string            `yaml:"user_data_dir"`
+	Headers     map[string]string `yaml:"headers"`
+	CookiesFile string            `yaml:"cookies_file"` // Netscape cookies.txt or JSON export
+}
+
+// All returns every configured overlay, plain URLs first.
+func (o OverlaysConfig) All() []OverlayConfig {
+	all := make([]OverlayConfig, 0, len(o.URLs)+len(o.Browsers))
+	for _, url := range o.URLs {
+		all = append(all, OverlayConfig{URL: url})
+	}
+	return append(all, o.Browsers...)
+}
+
+// Soundboard clip overlap policies
+const (
+	ClipPolicyCut   = "cut"   // Stop playing clips and start this one
+	ClipPolicyQueue = "queue" // Play after the clips already playing
+	ClipPolicyLayer = "layer" // Play on top of the clips already playing
+)
+
+type SoundboardConfig struct {
+	Directory       string                `yaml:"directory"`         // Clips are pre-decoded from here at startup
+	IncludeInStream bool                  `yaml:"include_in_stream"` // Also mix clips into the SRT output
+	DefaultPolicy   string                `yaml:"default_policy"`
+	Clips           map[string]ClipConfig `yaml:"clips"` // Per-clip overrides, keyed by file name without extension
+}
+
+type ClipConfig struct {
+	Policy string `yaml:"policy"`
+	Volume int    `yaml:"volume"` // Percent, 0 means 100
+}
+
+// PolicyFor returns the overlap policy of the given clip.
+func (s SoundboardConfig) PolicyFor(name string) string {
+	if c, ok := s.Clips[name]; ok && c.Policy != "" {
+		return c.Policy
+	}
+	if s.DefaultPolicy != "" {
+		return s.DefaultPolicy
+	}
+	return ClipPolicyLayer
+}
+
+func validOutputs(outputs []OutputConfig) error {
+	for _, o := range outputs {
+		switch o.Type {
+		case "", OutputSRT, OutputWHIP, OutputIcecast, OutputHLS:
+		default:
+			return fmt.Errorf("[ERR]: Invalid output type %q (srt, whip, icecast, hls)", o.Type)
+		}
+		if o.Type == OutputHLS {
+			if err := validHLSOutput(o); err != nil {
+				return err
+			}
+			continue
+		}
+		if o.URL == "" {
+			return fmt.Errorf("[ERR]: Stream output without url")
+		}
+		switch o.Engine {
+		case "", EngineNative, EngineFFmpeg:
+		default:
+			return fmt.Errorf("[ERR]: Invalid output engine %q (native, ffmpeg)", o.Engine)
+		}
+		if o.Type != OutputIcecast {
+			continue
+		}
+		if !strings.HasPrefix(o.Mount, "/") {
+			return fmt.Errorf("[ERR]: Icecast output %s needs a mount starting with /", o.URL)
+		}
+		switch o.Format {
+		case "", FormatOpus, FormatMP3:
+		default:
+			return fmt.Errorf("[ERR]: Invalid icecast format %q (opus, mp3)", o.Format)
+		}
+		switch o.Protocol {
+		case "", ProtocolPUT, ProtocolSOURCE:
+		default:
+			return fmt.Errorf("[ERR]: Invalid icecast protocol %q (put, source)", o.Protocol)
+		}
+		switch o.Metadata {
+		case "", MetadataSpeaker, MetadataTitle:
+		default:
+			return fmt.Errorf("[ERR]: Invalid icecast metadata %q (speaker, title)", o.Metadata)
+		}
+	}
+	return nil
+}
+
+// hlsMountPattern is a single path segment, served under /hls/ by the HTTP API.
+var hlsMountPattern = regexp.MustCompile(`^/[A-Za-z0-9_.-]+$`)
+
+func validHLSOutput(o OutputConfig) error {
+	if o.Directory == "" {
+		return fmt.Errorf("[ERR]: HLS output without directory")
+	}
+	if o.Mount != "" && !hlsMountPattern.MatchString(o.Mount) {
+		return fmt.Errorf("[ERR]: Invalid HLS mount %q (e.g. \"/vlx\")", o.Mount)
+	}
+	if o.SegmentSeconds < 0 || o.SegmentSeconds > 30 {
+		return fmt.Errorf("[ERR]: HLS segment_seconds must be between 1 and 30 (0 or unset uses the default of 4)")
+	}
+	if o.Window < 0 {
+		return fmt.Errorf("[ERR]: HLS window must not be negative")
+	}
+	return nil
+}
+
+func validLogLevel(l string) error {
+	if l == "" {
+		return nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l)); err != nil {
+		return fmt.Errorf("[ERR]: Invalid logging level %q (debug, info, warn, error)", l)
+	}
+	return nil
+}
+
+func validClipPolicy(p string) bool {
+	return p == "" || p == ClipPolicyCut || p == ClipPolicyQueue || p == ClipPolicyLayer
+}
+
+type TTSConfig struct {
+	Engine    string `yaml:"engine"`     // espeak-ng, piper or tone (test stub); empty disables "say"
+	Binary    string `yaml:"binary"`     // Optional path to the engine executable
+	Voice     string `yaml:"voice"`      // espeak-ng voice, e.g. "it" or "en-us"
+	Model     string `yaml:"model"`      // piper .onnx voice model
+	MaxLength int    `yaml:"max_length"` // Max characters per announcement, 0 means 300
+}
+
+// IngressConfig controls the Overlay -> Discord capture path.
+type IngressConfig struct {
+	Device        string            `yaml:"device"`         // Capture device name (substring), defaults to VLX_VirtualSink
+	DeviceRegex   string            `yaml:"device_regex"`   // Regex on the device name, takes precedence over device
+	AllowFallback bool              `yaml:"allow_fallback"` // Use pulse/default/first input if the device is missing
+	Encoder       OpusEncoderConfig `yaml:"encoder"`
+	Adaptive      AdaptiveConfig    `yaml:"adaptive"`
+	Silence       SilenceConfig     `yaml:"silence"`
+}
+
+// SilenceConfig controls when the ingress path stops transmitting.
+type SilenceConfig struct {
+	Continuous       bool    `yaml:"continuous"`        // Always transmit (previous behaviour)
+	ThresholdDB      float64 `yaml:"threshold_db"`      // Peak level in dBFS considered silent, 0 means -60
+	HangoverMs       int     `yaml:"hangover_ms"`       // Quiet time before the silence tail starts, 0 means 200
+	KeepaliveSeconds int     `yaml:"keepalive_seconds"` // Silence frame interval while idle (NAT keepalive), 0 means 5, -1 disables
+}
+
+// AdaptiveConfig lowers the ingress bitrate under send-queue congestion and restores it when healthy.
+type AdaptiveConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MinBitrate int  `yaml:"min_bitrate"` // bps floor, 0 means 24000
+}
+
+// OpusEncoderConfig tunes the ingress Opus encoder. Bitrate is always capped to the voice channel bitrate.
+type OpusEncoderConfig struct {
+	Application string `yaml:"application"` // audio (default), voip or lowdelay
+	Bitrate     int    `yaml:"bitrate"`     // bps, 0 means 128000
+	Complexity  int    `yaml:"complexity"`  // 1-10, 0 keeps the libopus default
+	CBR         bool   `yaml:"cbr"`         // Constant bitrate instead of VBR
+	FEC         bool   `yaml:"fec"`         // In-band forward error correction
+	PacketLoss  int    `yaml:"packet_loss"` // Expected packet loss in percent (0-100)
 }
 
 // Global config variable
@@ -46,12 +391,90 @@ func LoadConfig(path string) error {
 		return fmt.Errorf("[ERR]: YAML parsing error: %w", err)
 	}
 
+	for _, target := range cfg.Discord.AutoJoin {
+		if target.GuildID == "" || target.ChannelID == "" {
+			return fmt.Errorf("[ERR]: auto_join entries need guild_id and channel_id")
+		}
+		if !cfg.Discord.guildAllowed(target.GuildID) {
+			return fmt.Errorf("[ERR]: auto_join guild %s is not in guild_id or allowed_guilds", target.GuildID)
+		}
+	}
 	if len(cfg.Streaming.ExcludedUsers) > 2 {
 		return fmt.Errorf("[ERR]: Too many excluded users in config (max 2)")
 	}
-	if len(cfg.Overlays.URLs) > 3 {
+	if err := validOutputs(cfg.Streaming.Outputs); err != nil {
+		return err
+	}
+	if cfg.Streaming.Replay.Minutes < -1 || cfg.Streaming.Replay.Minutes > 30 {
+		return fmt.Errorf("[ERR]: Replay minutes must be between -1 (disabled) and 30")
+	}
+	for guildID, g := range cfg.Streaming.Guilds {
+		if err := validOutputs(g.Outputs); err != nil {
+			return fmt.Errorf("%w (streaming.guilds.%s)", err, guildID)
+		}
+	}
+	if len(cfg.Overlays.All()) > 3 {
 		return fmt.Errorf("[ERR]: Too many Overlays to connect to in config (max 3)")
 	}
+	profiles := make(map[string]string) // user_data_dir -> overlay URL
+	for _, o := range cfg.Overlays.Browsers {
+		if o.URL == "" {
+			return fmt.Errorf("[ERR]: Overlay browser entry without url")
+		}
+		if o.UserDataDir == "" {
+			continue
+		}
+		// Chromium refuses to start a second instance on the same profile
+		dir := filepath.Clean(o.UserDataDir)
+		if other, ok := profiles[dir]; ok {
+			return fmt.Errorf("[ERR]: Overlays %s and %s share user_data_dir %s; give each its own", other, o.URL, o.UserDataDir)
+		}
+		profiles[dir] = o.URL
+	}
+
+	if !validClipPolicy(cfg.Soundboard.DefaultPolicy) {
+		return fmt.Errorf("[ERR]: Invalid soundboard default_policy %q (cut, queue, layer)", cfg.Soundboard.DefaultPolicy)
+	}
+	for name, c := range cfg.Soundboard.Clips {
+		if !validClipPolicy(c.Policy) {
+			return fmt.Errorf("[ERR]: Invalid policy %q for soundboard clip %s (cut, queue, layer)", c.Policy, name)
+		}
+	}
+
+	switch cfg.Ingress.Encoder.Application {
+	case "", "audio", "voip", "lowdelay":
+	default:
+		return fmt.Errorf("[ERR]: Invalid encoder application %q (audio, voip, lowdelay)", cfg.Ingress.Encoder.Application)
+	}
+	if cfg.Ingress.Encoder.Complexity < 0 || cfg.Ingress.Encoder.Complexity > 10 {
+		return fmt.Errorf("[ERR]: Encoder complexity must be between 0 and 10")
+	}
+	if cfg.Ingress.Encoder.PacketLoss < 0 || cfg.Ingress.Encoder.PacketLoss > 100 {
+		return fmt.Errorf("[ERR]: Encoder packet_loss must be between 0 and 100")
+	}
+	if cfg.Ingress.DeviceRegex != "" {
+		if _, err := regexp.Compile(cfg.Ingress.DeviceRegex); err != nil {
+			return fmt.Errorf("[ERR]: Invalid ingress device_regex: %w", err)
+		}
+	}
+
+	switch cfg.Logging.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("[ERR]: Invalid logging format %q (text, json)", cfg.Logging.Format)
+	}
+	if err := validLogLevel(cfg.Logging.Level); err != nil {
+		return err
+	}
+	for _, l := range cfg.Logging.Levels {
+		if err := validLogLevel(l); err != nil {
+			return err
+		}
+	}
+
+	if cfg.HTTP.Bind != "" && cfg.HTTP.Token == "" {
+		return fmt.Errorf("[ERR]: http.token is required when http.bind is set")
+	}
 
 	Cfg = &cfg
 	return nil
@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+// Subsystem names, used as the "subsystem" field and as keys of logging.levels.
+const (
+	Main    = "main"
+	Bot     = "bot"
+	Audit   = "audit"
+	Stream  = "stream"
+	Overlay = "overlay"
+	Capture = "capture" // Overlay -> Discord ingress
+	Player  = "player"
+	API     = "api"
+	System  = "system"
+	Discord = "discord" // Library output written through the standard log package
+)
+
+var (
+	base atomic.Pointer[slog.Handler]
+
+	levelsMutex  sync.Mutex
+	levels       = make(map[string]*slog.LevelVar)
+	defaultLevel = slog.LevelInfo
+)
+
+func init() {
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, nil)
+	base.Store(&h)
+}
+
+// Setup applies the logging config. Loggers returned by For before Setup are updated too.
+func Setup(cfg config.LoggingConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	overrides := make(map[string]slog.Level)
+	for sub, l := range cfg.Levels {
+		parsed, err := ParseLevel(l)
+		if err != nil {
+			return fmt.Errorf("subsystem %s: %w", sub, err)
+		}
+		overrides[sub] = parsed
+	}
+
+	// Filtering happens per subsystem, the base handler lets everything through
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q (text, json)", cfg.Format)
+	}
+	base.Store(&h)
+
+	levelsMutex.Lock()
+	defaultLevel = level
+	for sub, lv := range levels {
+		if l, ok := overrides[sub]; ok {
+			lv.Set(l)
+		} else {
+			lv.Set(level)
+		}
+	}
+	for sub, l := range overrides {
+		if _, ok := levels[sub]; !ok {
+			lv := new(slog.LevelVar)
+			lv.Set(l)
+			levels[sub] = lv
+		}
+	}
+	levelsMutex.Unlock()
+
+	// Route the standard log package (used by discordgo) through slog
+	log.SetFlags(0)
+	log.SetOutput(writerFunc(func(p []byte) (int, error) {
+		For(Discord).Info(strings.TrimSpace(string(p)))
+		return len(p), nil
+	}))
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error ("" means info).
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return l, fmt.Errorf("invalid log level %q (debug, info, warn, error)", s)
+	}
+	return l, nil
+}
+
+// For returns the logger of a subsystem.
+func For(subsystem string) *slog.Logger {
+	levelsMutex.Lock()
+	lv, ok := levels[subsystem]
+	if !ok {
+		lv = new(slog.LevelVar)
+		lv.Set(defaultLevel)
+		levels[subsystem] = lv
+	}
+	levelsMutex.Unlock()
+
+	h := &handler{level: lv}
+	return slog.New(h).With("subsystem", subsystem)
+}
+
+// handler filters on the subsystem level and forwards to the current base handler,
+// so package-level loggers follow Setup.
+type handler struct {
+	level *slog.LevelVar
+	ops   []func(slog.Handler) slog.Handler // WithAttrs/WithGroup calls, replayed on the base
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	next := *base.Load()
+	for _, op := range h.ops {
+		next = op(next)
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &handler{level: h.level, ops: append(ops, op)}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// Fatal logs at error level and exits, like log.Fatal.
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
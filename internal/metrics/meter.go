@@ -0,0 +1,35 @@
+package metrics
+
+import "math"
+
+// Meter ballistics, applied once per 20ms frame.
+var peakDecay = math.Pow(10, -0.4/20) // Peak falls back 20 dB/s after a hit
+
+const vuSmoothing = 0.07 // Exponential RMS smoothing, ~300ms VU integration
+
+// Meter turns per-frame levels into peak-hold and VU readings for live displays.
+// It is not safe for concurrent use.
+type Meter struct {
+	peak       float64
+	meanSquare float64
+}
+
+// Update feeds the linear peak and mean square (1.0 = full scale) of one frame.
+func (m *Meter) Update(peak, meanSquare float64) {
+	if peak >= m.peak {
+		m.peak = peak
+	} else {
+		m.peak *= peakDecay
+	}
+	m.meanSquare += vuSmoothing * (meanSquare - m.meanSquare)
+}
+
+// PeakDB returns the held peak in dBFS.
+func (m *Meter) PeakDB() float64 {
+	return DBFS(m.peak)
+}
+
+// RMSDB returns the VU (smoothed RMS) level in dBFS.
+func (m *Meter) RMSDB() float64 {
+	return DBFS(math.Sqrt(m.meanSquare))
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vlx"
+
+// Level metric directions
+const (
+	DirectionEgress  = "egress"  // Discord -> SRT mix
+	DirectionIngress = "ingress" // Overlay -> Discord mix
+)
+
+// silenceFloorDB is reported for digital silence instead of -Inf.
+const silenceFloorDB = -100
+
+var startTime = time.Now()
+
+var (
+	// Egress (Discord -> SRT), per guild and user
+	PacketsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "egress", Name: "packets_received_total",
+		Help: "Opus packets received from Discord users.",
+	}, []string{"guild", "user"})
+	PacketsDecoded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "egress", Name: "packets_decoded_total",
+		Help: "Opus packets decoded and queued to the mixer.",
+	}, []string{"guild", "user"})
+	PacketsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "egress", Name: "packets_failed_total",
+		Help: "Opus packets that failed to decode.",
+	}, []string{"guild", "user"})
+
+	// Mixer
+	JitterBufferDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "mixer", Name: "jitter_buffer_frames",
+		Help: "Frames queued in the deepest per-user jitter buffer.",
+	}, []string{"guild"})
+	MixerFramesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "mixer", Name: "frames_dropped_total",
+		Help: "Mixed frames dropped because the output consumer was lagging.",
+	}, []string{"guild"})
+
+	// Stream outputs (SRT via FFmpeg, WHIP), per guild and output name
+	OutputRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "output", Name: "restarts_total",
+		Help: "Stream output restarts after it exited or stopped accepting audio.",
+	}, []string{"guild", "output"})
+	OutputFramesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "output", Name: "frames_dropped_total",
+		Help: "Mixed frames dropped because the output was lagging or reconnecting.",
+	}, []string{"guild", "output"})
+
+	// Ingress (Overlay -> Discord)
+	IngressUnderruns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "underruns_total",
+		Help: "Ticks without captured audio available.",
+	}, []string{"guild"})
+	IngressSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "packets_sent_total",
+		Help: "Opus packets queued to Discord.",
+	}, []string{"guild"})
+	IngressDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "packets_dropped_total",
+		Help: "Opus packets dropped because the Discord send queue was full.",
+	}, []string{"guild"})
+	IngressBitrate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "bitrate_bps",
+		Help: "Current ingress Opus encoder bitrate.",
+	}, []string{"guild"})
+
+	// Levels of the mixed audio, per 20ms frame
+	PeakLevel = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "audio", Name: "peak_dbfs",
+		Help: "Peak level of the last mixed frame in dBFS.",
+	}, []string{"guild", "direction"})
+	RMSLevel = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "audio", Name: "rms_dbfs",
+		Help: "RMS level of the last mixed frame in dBFS.",
+	}, []string{"guild", "direction"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "uptime_seconds",
+		Help: "Seconds since the process started.",
+	}, func() float64 { return time.Since(startTime).Seconds() })
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// DBFS converts a linear level (1.0 = full scale) to dBFS.
+func DBFS(level float64) float64 {
+	if level <= 0 {
+		return silenceFloorDB
+	}
+	db := 20 * math.Log10(level)
+	if db < silenceFloorDB {
+		return silenceFloorDB
+	}
+	return db
+}
+
+// ForgetGuild drops every series of a guild whose bridge was removed.
+func ForgetGuild(guildID string) {
+	labels := prometheus.Labels{"guild": guildID}
+	for _, vec := range []*prometheus.MetricVec{
+		PacketsReceived.MetricVec, PacketsDecoded.MetricVec, PacketsFailed.MetricVec,
+		JitterBufferDepth.MetricVec, MixerFramesDropped.MetricVec,
+		OutputRestarts.MetricVec, OutputFramesDropped.MetricVec,
+		IngressUnderruns.MetricVec, IngressSent.MetricVec, IngressDropped.MetricVec, IngressBitrate.MetricVec,
+		PeakLevel.MetricVec, RMSLevel.MetricVec,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
@@ -0,0 +1,176 @@
+package overlay
+
+import (
+	"log/slog"
+
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/metrics"
+	"github.com/hraban/opus"
+)
+
+const (
+	adaptWindowTicks  = 100  // 2s of 20ms frames per evaluation
+	congestedDropRate = 0.05 // Above this the bitrate is lowered
+	healthyDropRate   = 0.01 // Below this (for healthyWindows) the bitrate is raised
+	healthyWindows    = 3
+	underrunHoldRate  = 0.5 // Capture starving: drop counts are unreliable, keep settings
+	maxPacketLoss     = 30
+)
+
+// IngressStats reports the ingress encoder state and congestion counters.
+type IngressStats struct {
+	Bitrate    int     `json:"bitrate"`
+	PacketLoss int     `json:"packet_loss"`
+	FEC        bool    `json:"fec"`
+	Sent       uint64  `json:"sent"`
+	Dropped    uint64  `json:"dropped"`   // OpusSend full
+	Underruns  uint64  `json:"underruns"` // Capture buffer empty on tick
+	DropRate   float64 `json:"drop_rate"`
+}
+
+// adaptiveController lowers the Opus bitrate and raises FEC redundancy when OpusSend
+// congests, then climbs back towards the configured target once the path is healthy.
+type adaptiveController struct {
+	log        *slog.Logger
+	enabled    bool
+	target     int // Configured bitrate (already capped to the channel)
+	min        int
+	basePL     int
+	baseFEC    bool
+	bitrate    int
+	packetLoss int
+	fec        bool
+
+	// Counters for the current window
+	ticks     int
+	sent      int
+	dropped   int
+	underruns int
+	healthy   int
+
+	// Totals
+	totalSent      uint64
+	totalDropped   uint64
+	totalUnderruns uint64
+	lastDropRate   float64
+}
+
+func newAdaptiveController(log *slog.Logger, cfg config.IngressConfig, channelBitrate int) *adaptiveController {
+	target := EffectiveBitrate(cfg.Encoder, channelBitrate)
+	min := cfg.Adaptive.MinBitrate
+	if min <= 0 {
+		min = 24000
+	}
+	if min > target {
+		min = target
+	}
+	return &adaptiveController{
+		log:        log,
+		enabled:    cfg.Adaptive.Enabled,
+		target:     target,
+		min:        min,
+		basePL:     cfg.Encoder.PacketLoss,
+		baseFEC:    cfg.Encoder.FEC,
+		bitrate:    target,
+		packetLoss: cfg.Encoder.PacketLoss,
+		fec:        cfg.Encoder.FEC,
+	}
+}
+
+// tick closes the window every adaptWindowTicks calls and reports whether settings changed.
+func (a *adaptiveController) tick() bool {
+	a.ticks++
+	if a.ticks < adaptWindowTicks {
+		return false
+	}
+
+	total := a.sent + a.dropped
+	dropRate := 0.0
+	if total > 0 {
+		dropRate = float64(a.dropped) / float64(total)
+	}
+	underrunRate := float64(a.underruns) / float64(a.ticks)
+
+	a.totalSent += uint64(a.sent)
+	a.totalDropped += uint64(a.dropped)
+	a.totalUnderruns += uint64(a.underruns)
+	a.lastDropRate = dropRate
+	a.ticks, a.sent, a.dropped, a.underruns = 0, 0, 0, 0
+
+	if !a.enabled {
+		// Still publish counters once per window
+		return true
+	}
+
+	oldBitrate, oldPL := a.bitrate, a.packetLoss
+	switch {
+	case total == 0:
+		// Nothing transmitted (silence gate closed), no evidence either way
+	case dropRate > congestedDropRate:
+		a.healthy = 0
+		a.bitrate = a.bitrate * 3 / 4
+		if a.bitrate < a.min {
+			a.bitrate = a.min
+		}
+		a.packetLoss += 5
+		if a.packetLoss > maxPacketLoss {
+			a.packetLoss = maxPacketLoss
+		}
+		a.fec = true
+	case dropRate < healthyDropRate && underrunRate < underrunHoldRate:
+		a.healthy++
+		if a.healthy < healthyWindows {
+			break
+		}
+		a.healthy = 0
+		a.bitrate += a.target / 10
+		if a.bitrate > a.target {
+			a.bitrate = a.target
+		}
+		a.packetLoss -= 2
+		if a.packetLoss <= a.basePL {
+			a.packetLoss = a.basePL
+			a.fec = a.baseFEC
+		}
+	default:
+		a.healthy = 0
+	}
+
+	if a.bitrate != oldBitrate || a.packetLoss != oldPL {
+		a.log.Info("Adaptive bitrate changed", "from", oldBitrate, "to", a.bitrate,
+			"packet_loss", a.packetLoss, "fec", a.fec, "drop_rate", dropRate)
+	}
+	return true
+}
+
+// apply pushes the current settings to the encoder.
+func (a *adaptiveController) apply(encoder *opus.Encoder) {
+	if !a.enabled {
+		return
+	}
+	if err := encoder.SetBitrate(a.bitrate); err != nil {
+		a.log.Warn("Failed to set bitrate", "err", err)
+	}
+	if err := encoder.SetInBandFEC(a.fec); err != nil {
+		a.log.Warn("Failed to set FEC", "err", err)
+	}
+	if err := encoder.SetPacketLossPerc(a.packetLoss); err != nil {
+		a.log.Warn("Failed to set packet loss", "err", err)
+	}
+}
+
+// publish stores a stats snapshot for Stats().
+func (in *Ingress) publish(a *adaptiveController, dropRate float64) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	metrics.IngressBitrate.WithLabelValues(in.GuildID).Set(float64(a.bitrate))
+	in.stats = IngressStats{
+		Bitrate:    a.bitrate,
+		PacketLoss: a.packetLoss,
+		FEC:        a.fec,
+		Sent:       a.totalSent,
+		Dropped:    a.totalDropped,
+		Underruns:  a.totalUnderruns,
+		DropRate:   dropRate,
+	}
+}
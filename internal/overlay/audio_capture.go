@@ -2,15 +2,19 @@ package overlay
 
 import (
 	"fmt"
-	"log"
-	"strings"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/gordonklaus/portaudio"
-	"github.com/hraban/opus"
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
+	"VLX_AudioBridge/internal/metrics"
 )
 
+var captureLog = logging.For(logging.Capture)
+
 const (
 	SampleRate      = 48000
 	Channels        = 2
@@ -18,64 +22,86 @@ const (
 	BufferSize      = 50  // Ring buffer size (approx 1s) to mitigate jitter
 )
 
-// CaptureAndStream handles audio capture from system and streaming to Discord.
-func CaptureAndStream(vc *discordgo.VoiceConnection, stopChan <-chan struct{}) error {
-	log.Println("[AudioCapture] Initializing PortAudio...")
-	if err := portaudio.Initialize(); err != nil {
-		return fmt.Errorf("failed to initialize PortAudio: %w", err)
-	}
-	defer portaudio.Terminate()
+// Ingress is the Overlay -> Discord path of a voice connection.
+type Ingress struct {
+	GuildID        string
+	Config         config.IngressConfig
+	ChannelBitrate int      // Joined voice channel bitrate, caps the encoder (0 if unknown)
+	Sources        []Source // Mixed on top of the captured audio (e.g. the media Player)
+
+	mutex     sync.Mutex
+	stats     IngressStats
+	capturing bool
+	meter     metrics.Meter // Live level of the mixed ingress audio
+}
 
-	// --- Device Selection Logic ---
-	devices, err := portaudio.Devices()
-	if err != nil {
-		return fmt.Errorf("failed to list audio devices: %w", err)
-	}
+func NewIngress(guildID string, cfg config.IngressConfig, channelBitrate int, sources ...Source) *Ingress {
+	return &Ingress{GuildID: guildID, Config: cfg, ChannelBitrate: channelBitrate, Sources: sources}
+}
 
-	var inputDevice *portaudio.DeviceInfo
-	targetName := "VLX_VirtualSink"
+// Stats returns a snapshot of the ingress counters and current encoder settings.
+func (in *Ingress) Stats() IngressStats {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return in.stats
+}
 
-	for _, device := range devices {
-		if device.MaxInputChannels > 0 {
-			// Priority 1: Exact match for our sink monitor
-			if strings.Contains(device.Name, targetName) {
-				inputDevice = device
-				break
-			}
-			// Priority 2: Fallback to generic 'pulse' or 'default' devices
-			if inputDevice == nil && (device.Name == "pulse" || device.Name == "default") {
-				inputDevice = device
-			}
-		}
+// Capturing reports whether the capture device stream is open.
+func (in *Ingress) Capturing() bool {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return in.capturing
+}
+
+// Level returns the live peak and VU level of the ingress audio in dBFS.
+func (in *Ingress) Level() (peakDB, rmsDB float64) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return in.meter.PeakDB(), in.meter.RMSDB()
+}
+
+func (in *Ingress) setCapturing(capturing bool) {
+	in.mutex.Lock()
+	in.capturing = capturing
+	in.mutex.Unlock()
+}
+
+// CaptureAndStream handles audio capture from system and streaming to Discord.
+func (in *Ingress) CaptureAndStream(vc *discordgo.VoiceConnection, stopChan <-chan struct{}) error {
+	cfg := in.Config
+	log := captureLog.With("guild", in.GuildID, "channel", vc.ChannelID)
+	log.Info("Initializing PortAudio...")
+	if err := acquirePortAudio(); err != nil {
+		return err
 	}
+	defer releasePortAudio()
 
-	// Priority 3: Last resort fallback
-	if inputDevice == nil && len(devices) > 0 {
-		for _, d := range devices {
-			if d.MaxInputChannels > 0 {
-				inputDevice = d
-				break
-			}
-		}
+	// --- Device Selection Logic ---
+	devices, err := portAudioDevices()
+	if err != nil {
+		return err
 	}
 
-	if inputDevice == nil {
-		return fmt.Errorf("no suitable input device found")
+	inputDevice, err := selectInputDevice(log, devices, cfg)
+	if err != nil {
+		return err
 	}
-	log.Printf("[AudioCapture] Selected device: %s", inputDevice.Name)
+	log.Info("Selected capture device", "device", inputDevice.Name)
 
 	// --- Encoder Setup ---
-	encoder, err := opus.NewEncoder(SampleRate, Channels, opus.AppAudio)
+	encoder, err := newEncoder(log, cfg.Encoder, in.ChannelBitrate)
 	if err != nil {
-		return fmt.Errorf("failed to create Opus encoder: %w", err)
+		return err
 	}
-	encoder.SetBitrate(128000) // 64kbps for stability, 128000 for heroes
+	adaptive := newAdaptiveController(log, cfg, in.ChannelBitrate)
+	in.publish(adaptive, 0)
 
 	// --- Ring Buffer Channel ---
 	pcmChan := make(chan []float32, BufferSize)
 
 	// --- PortAudio Stream (Callback Mode) ---
 	// Uses callback to decouple audio capture timing from network timing
+	portAudioMutex.Lock()
 	stream, err := portaudio.OpenStream(portaudio.StreamParameters{
 		Input: portaudio.StreamDeviceParameters{
 			Device:   inputDevice,
@@ -95,22 +121,42 @@ func CaptureAndStream(vc *discordgo.VoiceConnection, stopChan <-chan struct{}) e
 	})
 
 	if err != nil {
+		portAudioMutex.Unlock()
 		return fmt.Errorf("failed to open audio stream: %w", err)
 	}
-	if err := stream.Start(); err != nil {
+	err = stream.Start()
+	portAudioMutex.Unlock()
+	defer func() {
+		portAudioMutex.Lock()
+		stream.Close()
+		portAudioMutex.Unlock()
+	}()
+	if err != nil {
 		return fmt.Errorf("failed to start audio stream: %w", err)
 	}
-	defer stream.Close()
+	in.setCapturing(true)
+	defer in.setCapturing(false)
+
+	log.Info("Streaming active via Jitter Buffer.")
 
-	log.Println("[AudioCapture] Streaming active via Jitter Buffer.")
+	// Speaking is toggled by the voice gate, make sure it is released on exit
+	gate := newVoiceGate(cfg.Silence)
+	defer func() {
+		if gate.speaking {
+			vc.Speaking(false)
+		}
+	}()
 
-	if err := vc.Speaking(true); err != nil {
-        log.Printf("[AudioCapture] Warning: Failed to set speaking status: %v", err)
-    }
-    defer vc.Speaking(false)
+	// Metrics, bound to the guild label
+	underruns := metrics.IngressUnderruns.WithLabelValues(in.GuildID)
+	sent := metrics.IngressSent.WithLabelValues(in.GuildID)
+	dropped := metrics.IngressDropped.WithLabelValues(in.GuildID)
+	peakLevel := metrics.PeakLevel.WithLabelValues(in.GuildID, metrics.DirectionIngress)
+	rmsLevel := metrics.RMSLevel.WithLabelValues(in.GuildID, metrics.DirectionIngress)
 
 	opusBuffer := make([]byte, 4000)
 	silence := make([]float32, FramesPerBuffer*Channels)
+	mixBuf := make([]float32, FramesPerBuffer*Channels)
 	
 	// --- Transmission Loop (Fixed 20ms Interval) ---
 	ticker := time.NewTicker(20 * time.Millisecond)
@@ -119,7 +165,7 @@ func CaptureAndStream(vc *discordgo.VoiceConnection, stopChan <-chan struct{}) e
 	for {
 		select {
 		case <-stopChan:
-			log.Println("[AudioCapture] Stop signal received.")
+			log.Info("Stop signal received.")
 			return nil
 		case <-ticker.C:
 			var frame []float32
@@ -128,20 +174,77 @@ func CaptureAndStream(vc *discordgo.VoiceConnection, stopChan <-chan struct{}) e
 			case frame = <-pcmChan:
 				// Audio data available
 			default:
-				// Buffer underrun: send silence to keep UDP connection alive
+				// Buffer underrun: treated as silence by the voice gate
 				frame = silence
+				adaptive.underruns++
+				underruns.Inc()
+			}
+
+			// Mix additional sources on top of the captured frame
+			copy(mixBuf, frame)
+			for _, src := range in.Sources {
+				src.Mix(mixBuf)
+			}
+			var sum float64
+			for i, v := range mixBuf {
+				if v > 1 {
+					mixBuf[i] = 1
+				} else if v < -1 {
+					mixBuf[i] = -1
+				}
+				sum += float64(mixBuf[i]) * float64(mixBuf[i])
+			}
+			framePeak, meanSquare := float64(peak(mixBuf)), sum/float64(len(mixBuf))
+			peakLevel.Set(metrics.DBFS(framePeak))
+			rmsLevel.Set(metrics.DBFS(math.Sqrt(meanSquare)))
+			in.mutex.Lock()
+			in.meter.Update(framePeak, meanSquare)
+			in.mutex.Unlock()
+
+			output, speakingChanged := gate.step(mixBuf)
+			if speakingChanged && gate.speaking {
+				if err := vc.Speaking(true); err != nil {
+					log.Warn("Failed to set speaking status", "err", err)
+				}
 			}
 
-			n, err := encoder.EncodeFloat32(frame, opusBuffer)
-			if err != nil {
-				continue
+			var packet []byte
+			switch output {
+			case gateAudio:
+				n, err := encoder.EncodeFloat32(mixBuf, opusBuffer)
+				if err != nil {
+					continue
+				}
+				// Copy: the voice sender reads the packet after we reuse opusBuffer
+				packet = make([]byte, n)
+				copy(packet, opusBuffer[:n])
+			case gateSilenceFrame:
+				packet = opusSilence
 			}
 
-			select {
-			case vc.OpusSend <- opusBuffer[:n]:
-				// Packet sent
-			default:
-				// Network congestion, drop packet
+			if packet != nil {
+				select {
+				case vc.OpusSend <- packet:
+					adaptive.sent++
+					sent.Inc()
+				default:
+					// Network congestion, drop packet
+					adaptive.dropped++
+					dropped.Inc()
+				}
+			}
+
+			// Release speaking only after the last tail frame was queued
+			if speakingChanged && !gate.speaking {
+				if err := vc.Speaking(false); err != nil {
+					log.Warn("Failed to clear speaking status", "err", err)
+				}
+			}
+
+			// Re-evaluate bitrate/FEC once per adaptation window
+			if adaptive.tick() {
+				adaptive.apply(encoder)
+				in.publish(adaptive, adaptive.lastDropRate)
 			}
 		}
 	}
@@ -1,54 +1,208 @@
 package overlay
 
 import (
-	"log"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
 )
 
-var activeBrowsers []*exec.Cmd
+// Each browser gets its own DevTools port, starting from this one.
+const baseDebugPort = 9222
+
+// MaxOverlays is the number of overlay browsers that may run at once.
+const MaxOverlays = 3
 
-// Start launches headless Chromium instances for given URLs.
-func Start(urls []string) error {
-	for _, url := range urls {
-		log.Printf("[Overlay] Launching headless browser for URL: %s", url)
+type browser struct {
+	config   config.OverlayConfig
+	port     int
+	cmd      *exec.Cmd
+	devtools *devtoolsClient // Open while injected headers must apply, guarded by browsersMutex
+}
 
-		// NOTE: "chromium" is the standard binary name on most Linux distros.
-		// "--autoplay-policy=no-user-gesture-required" is mandatory for audio in headless mode.
-		cmd := exec.Command("chromium",
-			"--headless",
-			"--disable-gpu",
-			"--no-sandbox",
-			"--remote-debugging-port=9222",
-			"--autoplay-policy=no-user-gesture-required",
-			"--disable-dev-shm-usage",
-			url,
-		)
+var overlayLog = logging.For(logging.Overlay)
 
-		// Inject PULSE_SINK to route audio to our virtual sink
-		env := os.Environ()
-		env = append(env, "PULSE_SINK=VLX_VirtualSink")
-		cmd.Env = env
+var (
+	browsersMutex  sync.Mutex
+	activeBrowsers []*browser
+)
+
+// Start launches headless Chromium instances for given overlays.
+func Start(overlays []config.OverlayConfig) error {
+	for _, o := range overlays {
+		if err := Add(o); err != nil {
+			overlayLog.Error("Failed to add overlay", "url", o.URL, "err", err)
+		}
+	}
+	return nil
+}
 
-		if err := cmd.Start(); err != nil {
-			log.Printf("[Overlay] Failed to start browser for %s: %v", url, err)
-			continue
+// Add launches a headless browser for one overlay.
+func Add(o config.OverlayConfig) error {
+	browsersMutex.Lock()
+	if len(activeBrowsers) >= MaxOverlays {
+		browsersMutex.Unlock()
+		return fmt.Errorf("too many overlays (max %d)", MaxOverlays)
+	}
+	for _, b := range activeBrowsers {
+		if b.config.URL == o.URL {
+			browsersMutex.Unlock()
+			return fmt.Errorf("overlay %s is already running", o.URL)
+		}
+		// Chromium refuses a profile already in use by another instance
+		if o.UserDataDir != "" && filepath.Clean(b.config.UserDataDir) == filepath.Clean(o.UserDataDir) {
+			browsersMutex.Unlock()
+			return fmt.Errorf("user_data_dir %s is already used by overlay %s", o.UserDataDir, b.config.URL)
 		}
+	}
+
+	overlayLog.Info("Launching headless browser", "url", o.URL)
+
+	port := freeDebugPortLocked()
+	// Authenticated overlays are loaded only after headers and cookies are injected
+	needsInjection := len(o.Headers) > 0 || o.CookiesFile != ""
 
-		activeBrowsers = append(activeBrowsers, cmd)
+	// NOTE: "chromium" is the standard binary name on most Linux distros.
+	// "--autoplay-policy=no-user-gesture-required" is mandatory for audio in headless mode.
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--no-sandbox",
+		fmt.Sprintf("--remote-debugging-port=%d", port),
+		"--autoplay-policy=no-user-gesture-required",
+		"--disable-dev-shm-usage",
+	}
+
+	// Persistent profile keeps logins and local storage across restarts
+	if o.UserDataDir != "" {
+		if err := os.MkdirAll(o.UserDataDir, 0700); err != nil {
+			browsersMutex.Unlock()
+			return fmt.Errorf("failed to create profile directory %s: %w", o.UserDataDir, err)
+		}
+		args = append(args, "--user-data-dir="+o.UserDataDir)
+	}
+
+	if needsInjection {
+		args = append(args, "about:blank")
+	} else {
+		args = append(args, o.URL)
+	}
+
+	cmd := exec.Command("chromium", args...)
+
+	// Inject PULSE_SINK to route audio to our virtual sink
+	env := os.Environ()
+	env = append(env, "PULSE_SINK=VLX_VirtualSink")
+	cmd.Env = env
+
+	if err := cmd.Start(); err != nil {
+		browsersMutex.Unlock()
+		return fmt.Errorf("failed to start browser for %s: %w", o.URL, err)
+	}
+
+	b := &browser{config: o, port: port, cmd: cmd}
+	activeBrowsers = append(activeBrowsers, b)
+	browsersMutex.Unlock()
+
+	// DevTools polling can take seconds: don't hold the lock or delay the other overlays
+	if needsInjection {
+		go inject(b)
 	}
 	return nil
 }
 
-// Stop terminates all active browser processes.
-func Stop() {
-	log.Println("[Overlay] Stopping all browser instances...")
-	for _, cmd := range activeBrowsers {
-		if cmd.Process != nil {
-			if err := cmd.Process.Kill(); err != nil {
-				log.Printf("[Overlay] Error killing process: %v", err)
+// inject sets up an authenticated overlay's headers and cookies and loads its URL.
+func inject(b *browser) {
+	client, err := injectAndNavigate(b.port, b.config)
+	if err != nil {
+		overlayLog.Error("DevTools injection failed", "url", b.config.URL, "err", err)
+		return
+	}
+	browsersMutex.Lock()
+	defer browsersMutex.Unlock()
+	if running(b) {
+		b.devtools = client
+	} else {
+		// Removed while injecting
+		client.close()
+	}
+}
+
+func running(b *browser) bool {
+	for _, active := range activeBrowsers {
+		if active == b {
+			return true
+		}
+	}
+	return false
+}
+
+// freeDebugPortLocked returns the first DevTools port not used by a running browser.
+func freeDebugPortLocked() int {
+	for port := baseDebugPort; ; port++ {
+		used := false
+		for _, b := range activeBrowsers {
+			if b.port == port {
+				used = true
+				break
 			}
 		}
+		if !used {
+			return port
+		}
+	}
+}
+
+// Remove terminates the browser showing the given URL. Returns false if none matched.
+func Remove(url string) bool {
+	browsersMutex.Lock()
+	defer browsersMutex.Unlock()
+	for i, b := range activeBrowsers {
+		if b.config.URL == url {
+			kill(b)
+			activeBrowsers = append(activeBrowsers[:i], activeBrowsers[i+1:]...)
+			overlayLog.Info("Removed overlay", "url", url)
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the overlays currently running.
+func List() []config.OverlayConfig {
+	browsersMutex.Lock()
+	defer browsersMutex.Unlock()
+	overlays := make([]config.OverlayConfig, 0, len(activeBrowsers))
+	for _, b := range activeBrowsers {
+		overlays = append(overlays, b.config)
+	}
+	return overlays
+}
+
+// Stop terminates all active browser processes.
+func Stop() {
+	overlayLog.Info("Stopping all browser instances...")
+	browsersMutex.Lock()
+	defer browsersMutex.Unlock()
+	for _, b := range activeBrowsers {
+		kill(b)
 	}
 	activeBrowsers = nil
 }
+
+func kill(b *browser) {
+	if b.devtools != nil {
+		b.devtools.close()
+	}
+	if b.cmd.Process != nil {
+		if err := b.cmd.Process.Kill(); err != nil {
+			overlayLog.Error("Error killing browser process", "url", b.config.URL, "err", err)
+		}
+		// Reap the process so it doesn't linger as a zombie
+		go b.cmd.Wait()
+	}
+}
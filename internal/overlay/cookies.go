@@ -0,0 +1,103 @@
+package overlay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cookieParam mirrors the DevTools Network.CookieParam object.
+type cookieParam struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	HTTPOnly bool    `json:"httpOnly,omitempty"`
+	Expires  float64 `json:"expires,omitempty"`
+}
+
+// loadCookies reads a JSON cookie export (*.json) or a Netscape cookies.txt file.
+func loadCookies(path string) ([]cookieParam, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return loadJSONCookies(path)
+	}
+	return loadNetscapeCookies(path)
+}
+
+func loadJSONCookies(path string) ([]cookieParam, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cookie file: %w", err)
+	}
+
+	// Browser extensions export "expirationDate", DevTools uses "expires"
+	var raw []struct {
+		cookieParam
+		ExpirationDate float64 `json:"expirationDate"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON cookie file %s: %w", path, err)
+	}
+
+	cookies := make([]cookieParam, 0, len(raw))
+	for _, c := range raw {
+		if c.Expires == 0 {
+			c.Expires = c.ExpirationDate
+		}
+		cookies = append(cookies, c.cookieParam)
+	}
+	return cookies, nil
+}
+
+func loadNetscapeCookies(path string) ([]cookieParam, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cookie file: %w", err)
+	}
+	defer f.Close()
+
+	var cookies []cookieParam
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// curl/wget mark HttpOnly cookies with a comment-like prefix
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			httpOnly = true
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiry, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab-separated fields, got %d", path, lineNo, len(fields))
+		}
+		expires, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiry %q", path, lineNo, fields[4])
+		}
+
+		cookies = append(cookies, cookieParam{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Expires:  expires,
+			Name:     fields[5],
+			Value:    fields[6],
+			HTTPOnly: httpOnly,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read cookie file: %w", err)
+	}
+	return cookies, nil
+}
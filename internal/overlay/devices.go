@@ -0,0 +1,163 @@
+package overlay
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"VLX_AudioBridge/internal/config"
+	"github.com/gordonklaus/portaudio"
+)
+
+// InputDevice describes a PortAudio capture device.
+type InputDevice struct {
+	Name     string
+	Channels int
+	Selected bool // Matches the configured capture device
+}
+
+// PortAudio is not thread-safe, and one guild's Terminate must not pull the
+// library from under another guild's capture: all calls into it hold
+// portAudioMutex, and it is initialized once for all users.
+var (
+	portAudioMutex sync.Mutex
+	portAudioRefs  int
+)
+
+func acquirePortAudio() error {
+	portAudioMutex.Lock()
+	defer portAudioMutex.Unlock()
+	if portAudioRefs == 0 {
+		if err := portaudio.Initialize(); err != nil {
+			return fmt.Errorf("failed to initialize PortAudio: %w", err)
+		}
+	}
+	portAudioRefs++
+	return nil
+}
+
+func releasePortAudio() {
+	portAudioMutex.Lock()
+	defer portAudioMutex.Unlock()
+	portAudioRefs--
+	if portAudioRefs == 0 {
+		portaudio.Terminate()
+	}
+}
+
+func portAudioDevices() ([]*portaudio.DeviceInfo, error) {
+	portAudioMutex.Lock()
+	defer portAudioMutex.Unlock()
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audio devices: %w", err)
+	}
+	return devices, nil
+}
+
+// ListInputDevices returns all PortAudio devices able to capture audio.
+func ListInputDevices(cfg config.IngressConfig) ([]InputDevice, error) {
+	if err := acquirePortAudio(); err != nil {
+		return nil, err
+	}
+	defer releasePortAudio()
+
+	devices, err := portAudioDevices()
+	if err != nil {
+		return nil, err
+	}
+	match, err := deviceMatcher(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []InputDevice
+	for _, d := range devices {
+		if d.MaxInputChannels > 0 {
+			inputs = append(inputs, InputDevice{Name: d.Name, Channels: d.MaxInputChannels, Selected: match(d.Name)})
+		}
+	}
+	return inputs, nil
+}
+
+// CheckInputDevice resolves the configured capture device, so a join can be
+// refused up front instead of failing later in the capture goroutine.
+func CheckInputDevice(cfg config.IngressConfig) (string, error) {
+	if err := acquirePortAudio(); err != nil {
+		return "", err
+	}
+	defer releasePortAudio()
+
+	devices, err := portAudioDevices()
+	if err != nil {
+		return "", err
+	}
+	device, err := selectInputDevice(captureLog, devices, cfg)
+	if err != nil {
+		return "", err
+	}
+	return device.Name, nil
+}
+
+// deviceMatcher builds the name check for the configured device (regex wins over plain name).
+func deviceMatcher(cfg config.IngressConfig) (func(string) bool, error) {
+	if cfg.DeviceRegex != "" {
+		re, err := regexp.Compile(cfg.DeviceRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture device_regex: %w", err)
+		}
+		return re.MatchString, nil
+	}
+
+	name := cfg.Device
+	if name == "" {
+		name = "VLX_VirtualSink"
+	}
+	return func(deviceName string) bool { return strings.Contains(deviceName, name) }, nil
+}
+
+// selectInputDevice picks the configured capture device.
+// Falling back to another input is refused unless explicitly allowed: a random microphone must never go on air.
+func selectInputDevice(log *slog.Logger, devices []*portaudio.DeviceInfo, cfg config.IngressConfig) (*portaudio.DeviceInfo, error) {
+	match, err := deviceMatcher(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []string
+	for _, device := range devices {
+		if device.MaxInputChannels > 0 {
+			if match(device.Name) {
+				return device, nil
+			}
+			inputs = append(inputs, device.Name)
+		}
+	}
+
+	if !cfg.AllowFallback {
+		return nil, fmt.Errorf("configured capture device not found (available inputs: %s)", strings.Join(inputs, ", "))
+	}
+
+	var inputDevice *portaudio.DeviceInfo
+	for _, device := range devices {
+		if device.MaxInputChannels > 0 {
+			// Priority 1: Generic 'pulse' or 'default' devices
+			if device.Name == "pulse" || device.Name == "default" {
+				inputDevice = device
+				break
+			}
+			// Priority 2: First available input
+			if inputDevice == nil {
+				inputDevice = device
+			}
+		}
+	}
+
+	if inputDevice == nil {
+		return nil, fmt.Errorf("no suitable input device found")
+	}
+	log.Warn("Configured device not found, falling back", "device", inputDevice.Name)
+	return inputDevice, nil
+}
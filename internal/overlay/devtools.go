@@ -0,0 +1,143 @@
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+// devtoolsTarget is the subset of /json/list we need to reach the page.
+type devtoolsTarget struct {
+	Type                 string `json:"type"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+// devtoolsClient is a minimal Chrome DevTools Protocol client (request/response only).
+type devtoolsClient struct {
+	conn   *websocket.Conn
+	nextID int
+}
+
+// injectAndNavigate sets extra headers and cookies on the page, then loads the overlay URL.
+// Chrome drops the extra headers when the DevTools session ends, so the returned
+// client must stay open for the browser's lifetime (events are drained in the background).
+func injectAndNavigate(port int, o config.OverlayConfig) (*devtoolsClient, error) {
+	wsURL, err := waitForPageTarget(port, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DevTools: %w", err)
+	}
+	client := &devtoolsClient{conn: conn}
+	if err := client.inject(o); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go client.drain()
+	return client, nil
+}
+
+func (c *devtoolsClient) inject(o config.OverlayConfig) error {
+	if err := c.call("Network.enable", nil); err != nil {
+		return err
+	}
+
+	if len(o.Headers) > 0 {
+		if err := c.call("Network.setExtraHTTPHeaders", map[string]interface{}{"headers": o.Headers}); err != nil {
+			return err
+		}
+	}
+
+	if o.CookiesFile != "" {
+		cookies, err := loadCookies(o.CookiesFile)
+		if err != nil {
+			return err
+		}
+		if err := c.call("Network.setCookies", map[string]interface{}{"cookies": cookies}); err != nil {
+			return err
+		}
+		overlayLog.Info("Injected cookies", "url", o.URL, "cookies", len(cookies), "file", o.CookiesFile)
+	}
+
+	return c.call("Page.navigate", map[string]interface{}{"url": o.URL})
+}
+
+// drain discards CDP events (Network.enable keeps them coming) until the connection closes.
+func (c *devtoolsClient) drain() {
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *devtoolsClient) close() {
+	c.conn.Close()
+}
+
+// waitForPageTarget polls the DevTools HTTP endpoint until the browser exposes a page.
+func waitForPageTarget(port int, timeout time.Duration) (string, error) {
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/json/list", port)
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(endpoint)
+		if err == nil {
+			var targets []devtoolsTarget
+			decodeErr := json.NewDecoder(resp.Body).Decode(&targets)
+			resp.Body.Close()
+			if decodeErr == nil {
+				for _, t := range targets {
+					if t.Type == "page" && t.WebSocketDebuggerURL != "" {
+						return t.WebSocketDebuggerURL, nil
+					}
+				}
+			}
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return "", fmt.Errorf("DevTools on port %d not available after %s", port, timeout)
+}
+
+// call sends a CDP command and waits for its response, skipping unrelated events.
+func (c *devtoolsClient) call(method string, params interface{}) error {
+	c.nextID++
+	id := c.nextID
+
+	req := map[string]interface{}{"id": id, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	if err := c.conn.WriteJSON(req); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	for {
+		var resp struct {
+			ID    int `json:"id"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := c.conn.ReadJSON(&resp); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		if resp.ID != id {
+			continue
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %s", method, resp.Error.Message)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package overlay
+
+import (
+	"fmt"
+	"log/slog"
+
+	"VLX_AudioBridge/internal/config"
+	"github.com/hraban/opus"
+)
+
+const (
+	DefaultBitrate = 128000 // 64kbps for stability, 128000 for heroes
+	MinBitrate     = 6000   // Opus lower bound
+	MaxBitrate     = 510000 // Opus upper bound
+)
+
+// EffectiveBitrate returns the configured bitrate clamped to Opus limits and to the
+// voice channel bitrate (channelBitrate <= 0 means unknown).
+func EffectiveBitrate(cfg config.OpusEncoderConfig, channelBitrate int) int {
+	bitrate := cfg.Bitrate
+	if bitrate <= 0 {
+		bitrate = DefaultBitrate
+	}
+	if channelBitrate > 0 && bitrate > channelBitrate {
+		bitrate = channelBitrate
+	}
+	if bitrate < MinBitrate {
+		bitrate = MinBitrate
+	} else if bitrate > MaxBitrate {
+		bitrate = MaxBitrate
+	}
+	return bitrate
+}
+
+func opusApplication(name string) (opus.Application, error) {
+	switch name {
+	case "", "audio":
+		return opus.AppAudio, nil
+	case "voip":
+		return opus.AppVoIP, nil
+	case "lowdelay":
+		return opus.AppRestrictedLowdelay, nil
+	default:
+		return 0, fmt.Errorf("unknown Opus application %q", name)
+	}
+}
+
+// newEncoder creates the ingress Opus encoder from config.
+func newEncoder(log *slog.Logger, cfg config.OpusEncoderConfig, channelBitrate int) (*opus.Encoder, error) {
+	app, err := opusApplication(cfg.Application)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := opus.NewEncoder(SampleRate, Channels, app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus encoder: %w", err)
+	}
+
+	bitrate := EffectiveBitrate(cfg, channelBitrate)
+	if err := encoder.SetBitrate(bitrate); err != nil {
+		return nil, fmt.Errorf("failed to set Opus bitrate: %w", err)
+	}
+	if cfg.Complexity > 0 {
+		if err := encoder.SetComplexity(cfg.Complexity); err != nil {
+			return nil, fmt.Errorf("failed to set Opus complexity: %w", err)
+		}
+	}
+	if err := encoder.SetVBR(!cfg.CBR); err != nil {
+		return nil, fmt.Errorf("failed to set Opus VBR mode: %w", err)
+	}
+	if err := encoder.SetInBandFEC(cfg.FEC); err != nil {
+		return nil, fmt.Errorf("failed to set Opus FEC: %w", err)
+	}
+	if err := encoder.SetPacketLossPerc(cfg.PacketLoss); err != nil {
+		return nil, fmt.Errorf("failed to set Opus packet loss: %w", err)
+	}
+
+	mode := "VBR"
+	if cfg.CBR {
+		mode = "CBR"
+	}
+	log.Info("Opus encoder configured", "bitrate", bitrate, "mode", mode, "complexity", cfg.Complexity,
+		"fec", cfg.FEC, "packet_loss", cfg.PacketLoss, "channel_bitrate", channelBitrate)
+	return encoder, nil
+}
@@ -0,0 +1,255 @@
+package overlay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"sync"
+
+	"VLX_AudioBridge/internal/logging"
+)
+
+var playerLog = logging.For(logging.Player)
+
+// Source is an additional PCM producer mixed into the ingress stream next to the PortAudio capture.
+type Source interface {
+	// Mix adds the next 20ms interleaved stereo frame into out.
+	// Returns false if the source had nothing to contribute this tick.
+	Mix(out []float32) bool
+}
+
+// track is a single queued item, decoded to 48kHz stereo float32 by FFmpeg.
+type track struct {
+	source string
+	cmd    *exec.Cmd
+	frames chan []float32
+	done   chan struct{}
+}
+
+// queueItem is either a file/URL to decode or PCM already in memory (e.g. TTS output).
+type queueItem struct {
+	source string
+	pcm    []float32
+}
+
+// Player plays local files and URLs into the voice channel with a FIFO queue.
+type Player struct {
+	mutex   sync.Mutex
+	queue   []queueItem
+	current *track
+	volume  float32
+}
+
+func NewPlayer() *Player {
+	return &Player{volume: 1.0}
+}
+
+// Enqueue adds a file path or URL to the playback queue.
+func (p *Player) Enqueue(source string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queue = append(p.queue, queueItem{source: source})
+}
+
+// EnqueuePCM adds in-memory 48kHz stereo PCM to the playback queue under a display name.
+func (p *Player) EnqueuePCM(name string, pcm []float32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queue = append(p.queue, queueItem{source: name, pcm: pcm})
+}
+
+// Skip stops the current track; playback continues with the next queued item.
+func (p *Player) Skip() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.current == nil {
+		return false
+	}
+	p.current.stop()
+	p.current = nil
+	return true
+}
+
+// Stop halts playback and clears the queue.
+func (p *Player) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queue = nil
+	if p.current != nil {
+		p.current.stop()
+		p.current = nil
+	}
+}
+
+// SetVolume sets the playback gain (1.0 = unity).
+func (p *Player) SetVolume(v float32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.volume = v
+}
+
+func (p *Player) Volume() float32 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.volume
+}
+
+// NowPlaying returns the current track and the pending queue.
+func (p *Player) NowPlaying() (string, []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	current := ""
+	if p.current != nil {
+		current = p.current.source
+	}
+	queue := make([]string, len(p.queue))
+	for i, item := range p.queue {
+		queue[i] = item.source
+	}
+	return current, queue
+}
+
+// Mix implements Source. Called from the 20ms ingress loop, it never blocks on the decoder.
+func (p *Player) Mix(out []float32) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.current == nil {
+		if len(p.queue) == 0 {
+			return false
+		}
+		item := p.queue[0]
+		p.queue = p.queue[1:]
+
+		if item.pcm != nil {
+			p.current = startPCMTrack(item.source, item.pcm)
+		} else {
+			t, err := startTrack(item.source)
+			if err != nil {
+				playerLog.Error("Failed to play", "source", item.source, "err", err)
+				return false
+			}
+			p.current = t
+		}
+		playerLog.Info("Now playing", "source", item.source)
+	}
+
+	select {
+	case frame, ok := <-p.current.frames:
+		if !ok {
+			// Track finished, next one starts on the following tick
+			p.current.stop()
+			p.current = nil
+			return false
+		}
+		for i := 0; i < len(out) && i < len(frame); i++ {
+			out[i] += frame[i] * p.volume
+		}
+		return true
+	default:
+		// Decoder still buffering (e.g. remote URL)
+		return false
+	}
+}
+
+// decodeCommand builds an FFmpeg decode subprocess producing raw 48kHz stereo f32le PCM on stdout.
+func decodeCommand(source string) *exec.Cmd {
+	return exec.Command("ffmpeg",
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", source,
+		"-f", "f32le",
+		"-ar", fmt.Sprint(SampleRate),
+		"-ac", fmt.Sprint(Channels),
+		"pipe:1",
+	)
+}
+
+// startTrack starts decoding source in the background.
+func startTrack(source string) (*track, error) {
+	cmd := decodeCommand(source)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ffmpeg stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	t := &track{
+		source: source,
+		cmd:    cmd,
+		frames: make(chan []float32, BufferSize),
+		done:   make(chan struct{}),
+	}
+	go t.read(stdout)
+	return t, nil
+}
+
+// startPCMTrack feeds in-memory PCM through the same frame channel used by decoded tracks.
+func startPCMTrack(name string, pcm []float32) *track {
+	t := &track{
+		source: name,
+		frames: make(chan []float32, BufferSize),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(t.frames)
+		frameLen := FramesPerBuffer * Channels
+		for pos := 0; pos < len(pcm); pos += frameLen {
+			frame := make([]float32, frameLen)
+			copy(frame, pcm[pos:])
+			select {
+			case t.frames <- frame:
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// read splits the decoder output into 20ms frames. A short last frame is zero padded.
+func (t *track) read(r io.Reader) {
+	defer close(t.frames)
+	raw := make([]byte, FramesPerBuffer*Channels*4)
+
+	for {
+		n, err := io.ReadFull(r, raw)
+		if n > 0 {
+			frame := make([]float32, FramesPerBuffer*Channels)
+			for i := 0; i < n/4; i++ {
+				frame[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+			}
+			select {
+			case t.frames <- frame:
+			case <-t.done:
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				playerLog.Warn("Decoder read error", "source", t.source, "err", err)
+			}
+			return
+		}
+	}
+}
+
+func (t *track) stop() {
+	select {
+	case <-t.done:
+		return
+	default:
+		close(t.done)
+	}
+	if t.cmd == nil {
+		return
+	}
+	if t.cmd.Process != nil {
+		t.cmd.Process.Kill()
+	}
+	go t.cmd.Wait()
+}
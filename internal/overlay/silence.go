@@ -0,0 +1,116 @@
+package overlay
+
+import (
+	"math"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+// Number of Opus silence frames sent after speech before releasing the speaking flag,
+// as required by Discord to avoid interpolation artifacts.
+const silenceTailFrames = 5
+
+// opusSilence is the standard 20ms Opus silence frame.
+var opusSilence = []byte{0xF8, 0xFF, 0xFE}
+
+type gateOutput int
+
+const (
+	gateIdle         gateOutput = iota // Send nothing
+	gateAudio                          // Encode and send the mixed frame
+	gateSilenceFrame                   // Send opusSilence (tail or NAT keepalive)
+)
+
+// voiceGate decides per 20ms tick whether audio is transmitted and drives the speaking flag.
+type voiceGate struct {
+	continuous     bool
+	threshold      float32 // Linear peak level below which a frame is silent
+	hangoverTicks  int
+	keepaliveTicks int
+
+	speaking bool
+	quiet    int // Consecutive silent ticks while speaking
+	tail     int // Silence frames left before speaking=false
+	idle     int // Ticks since the last packet while not speaking
+}
+
+func newVoiceGate(cfg config.SilenceConfig) *voiceGate {
+	thresholdDB := cfg.ThresholdDB
+	if thresholdDB == 0 {
+		thresholdDB = -60
+	}
+	hangover := cfg.HangoverMs
+	if hangover <= 0 {
+		hangover = 200
+	}
+	keepalive := cfg.KeepaliveSeconds
+	if keepalive == 0 {
+		keepalive = 5
+	}
+
+	g := &voiceGate{
+		continuous:    cfg.Continuous,
+		threshold:     float32(math.Pow(10, thresholdDB/20)),
+		hangoverTicks: hangover / 20,
+	}
+	if keepalive > 0 {
+		g.keepaliveTicks = keepalive * 50
+		// First idle tick sends a frame right away, opening the NAT mapping after join
+		g.idle = g.keepaliveTicks - 1
+	}
+	return g
+}
+
+// step advances the gate by one tick. speakingChanged reports that g.speaking flipped
+// and vc.Speaking must be updated.
+func (g *voiceGate) step(frame []float32) (out gateOutput, speakingChanged bool) {
+	if g.continuous || peak(frame) >= g.threshold {
+		g.quiet, g.tail, g.idle = 0, 0, 0
+		if !g.speaking {
+			g.speaking = true
+			return gateAudio, true
+		}
+		return gateAudio, false
+	}
+
+	// Silence tail in progress
+	if g.tail > 0 {
+		g.tail--
+		if g.tail == 0 {
+			g.speaking = false
+			return gateSilenceFrame, true
+		}
+		return gateSilenceFrame, false
+	}
+
+	if g.speaking {
+		g.quiet++
+		if g.quiet <= g.hangoverTicks {
+			// Keep sending the (quiet) audio so word endings aren't clipped
+			return gateAudio, false
+		}
+		g.tail = silenceTailFrames - 1
+		return gateSilenceFrame, false
+	}
+
+	// Idle: occasional silence frame keeps the NAT mapping (and the receive path) alive
+	g.idle++
+	if g.keepaliveTicks > 0 && g.idle >= g.keepaliveTicks {
+		g.idle = 0
+		return gateSilenceFrame, false
+	}
+	return gateIdle, false
+}
+
+func peak(frame []float32) float32 {
+	var p float32
+	for _, v := range frame {
+		if v < 0 {
+			v = -v
+		}
+		if v > p {
+			p = v
+		}
+	}
+	return p
+}
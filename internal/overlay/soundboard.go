@@ -0,0 +1,223 @@
+package overlay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+// Clips longer than this are skipped to keep the pre-decoded soundboard small.
+const maxClipSeconds = 30
+
+var clipExtensions = map[string]bool{".wav": true, ".flac": true, ".ogg": true, ".opus": true, ".mp3": true}
+
+// Clip is a pre-decoded sound effect held in memory.
+type Clip struct {
+	Name   string
+	PCM    []float32 // Interleaved 48kHz stereo
+	Policy string
+	Gain   float32
+}
+
+// clipVoice is a clip currently being played.
+type clipVoice struct {
+	clip *Clip
+	pos  int
+}
+
+// Soundboard triggers pre-loaded clips instantly, honouring each clip's overlap policy.
+type Soundboard struct {
+	mutex   sync.Mutex
+	clips   map[string]*Clip
+	voices  []*clipVoice
+	pending []*Clip
+	sfxBuf  []float32
+	tapBuf  []int16
+
+	// StreamTap, when set, receives every soundboard frame for the SRT mix.
+	StreamTap func(pcm []int16)
+}
+
+// LoadSoundboard decodes every supported file in the configured directory into memory.
+func LoadSoundboard(cfg config.SoundboardConfig) (*Soundboard, error) {
+	sb := &Soundboard{
+		clips:  make(map[string]*Clip),
+		sfxBuf: make([]float32, FramesPerBuffer*Channels),
+		tapBuf: make([]int16, FramesPerBuffer*Channels),
+	}
+	if cfg.Directory == "" {
+		return sb, nil
+	}
+
+	entries, err := os.ReadDir(cfg.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read soundboard directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !clipExtensions[ext] {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+
+		pcm, err := decodeClip(filepath.Join(cfg.Directory, entry.Name()))
+		if err != nil {
+			playerLog.Warn("Skipping soundboard clip", "file", entry.Name(), "err", err)
+			continue
+		}
+
+		gain := float32(1.0)
+		if c, ok := cfg.Clips[name]; ok && c.Volume > 0 {
+			gain = float32(c.Volume) / 100
+		}
+		sb.clips[name] = &Clip{Name: name, PCM: pcm, Policy: cfg.PolicyFor(name), Gain: gain}
+	}
+
+	playerLog.Info("Soundboard loaded", "clips", len(sb.clips), "directory", cfg.Directory)
+	return sb, nil
+}
+
+// decodeClip runs FFmpeg to completion and returns the whole clip as PCM.
+func decodeClip(path string) ([]float32, error) {
+	pcm, err := DecodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("empty clip")
+	}
+	if len(pcm) > maxClipSeconds*SampleRate*Channels {
+		return nil, fmt.Errorf("clip longer than %ds", maxClipSeconds)
+	}
+	return pcm, nil
+}
+
+// DecodeFile decodes a whole audio file to 48kHz interleaved stereo float32 PCM.
+func DecodeFile(path string) ([]float32, error) {
+	raw, err := decodeCommand(path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg decode failed: %w", err)
+	}
+	pcm := make([]float32, len(raw)/4)
+	for i := range pcm {
+		pcm[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return pcm, nil
+}
+
+// Clone returns a soundboard sharing the decoded clips with its own playback state.
+// The clip map is read-only after loading, so it is safe to share.
+func (sb *Soundboard) Clone() *Soundboard {
+	return &Soundboard{
+		clips:  sb.clips,
+		sfxBuf: make([]float32, FramesPerBuffer*Channels),
+		tapBuf: make([]int16, FramesPerBuffer*Channels),
+	}
+}
+
+// Names returns the loaded clip names, sorted.
+func (sb *Soundboard) Names() []string {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	names := make([]string, 0, len(sb.clips))
+	for name := range sb.clips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Trigger starts the named clip according to its overlap policy.
+func (sb *Soundboard) Trigger(name string) error {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	clip, ok := sb.clips[name]
+	if !ok {
+		return fmt.Errorf("unknown clip %q", name)
+	}
+
+	switch clip.Policy {
+	case config.ClipPolicyCut:
+		sb.voices = []*clipVoice{{clip: clip}}
+		sb.pending = nil
+	case config.ClipPolicyQueue:
+		if len(sb.voices) == 0 {
+			sb.voices = append(sb.voices, &clipVoice{clip: clip})
+		} else {
+			sb.pending = append(sb.pending, clip)
+		}
+	default:
+		sb.voices = append(sb.voices, &clipVoice{clip: clip})
+	}
+	return nil
+}
+
+// Silence stops all playing and queued clips.
+func (sb *Soundboard) Silence() {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	sb.voices = nil
+	sb.pending = nil
+}
+
+// Mix implements Source.
+func (sb *Soundboard) Mix(out []float32) bool {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	if len(sb.voices) == 0 && len(sb.pending) > 0 {
+		sb.voices = append(sb.voices, &clipVoice{clip: sb.pending[0]})
+		sb.pending = sb.pending[1:]
+	}
+	if len(sb.voices) == 0 {
+		return false
+	}
+
+	for i := range sb.sfxBuf {
+		sb.sfxBuf[i] = 0
+	}
+
+	active := sb.voices[:0]
+	for _, v := range sb.voices {
+		n := copyGain(sb.sfxBuf, v.clip.PCM[v.pos:], v.clip.Gain)
+		v.pos += n
+		if v.pos < len(v.clip.PCM) {
+			active = append(active, v)
+		}
+	}
+	sb.voices = active
+
+	for i := 0; i < len(out) && i < len(sb.sfxBuf); i++ {
+		out[i] += sb.sfxBuf[i]
+	}
+
+	if sb.StreamTap != nil {
+		for i, v := range sb.sfxBuf {
+			v = float32(math.Max(-1, math.Min(1, float64(v))))
+			sb.tapBuf[i] = int16(v * 32767)
+		}
+		sb.StreamTap(sb.tapBuf)
+	}
+	return true
+}
+
+// copyGain adds src*gain into dst and returns the number of samples consumed.
+func copyGain(dst, src []float32, gain float32) int {
+	n := len(dst)
+	if len(src) < n {
+		n = len(src)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] += src[i] * gain
+	}
+	return n
+}
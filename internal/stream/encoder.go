@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hraban/opus"
+)
+
+// Mixed frames are 20ms of interleaved 48kHz stereo.
+const (
+	frameDuration = 20 * time.Millisecond
+	frameSamples  = 960
+)
+
+// frameEncoder Opus-encodes mixed s16le frames for the native outputs.
+type frameEncoder struct {
+	encoder *opus.Encoder
+	bitrate int
+	pcm     []int16
+	packet  []byte
+}
+
+func newFrameEncoder(bitrate string) (*frameEncoder, error) {
+	bps, err := parseBitrate(bitrate)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := opus.NewEncoder(48000, 2, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opus encoder: %w", err)
+	}
+	if err := encoder.SetBitrate(bps); err != nil {
+		return nil, fmt.Errorf("failed to set opus bitrate %d: %w", bps, err)
+	}
+	return &frameEncoder{
+		encoder: encoder,
+		bitrate: bps,
+		pcm:     make([]int16, frameSamples*2),
+		packet:  make([]byte, 4000),
+	}, nil
+}
+
+// encode returns the Opus packet for one frame. It is only valid until the next call.
+func (e *frameEncoder) encode(pcmData []byte) ([]byte, error) {
+	if len(pcmData) != len(e.pcm)*2 {
+		return nil, fmt.Errorf("unexpected frame size %d", len(pcmData))
+	}
+	for i := range e.pcm {
+		e.pcm[i] = int16(binary.LittleEndian.Uint16(pcmData[i*2:]))
+	}
+	n, err := e.encoder.Encode(e.pcm, e.packet)
+	if err != nil {
+		return nil, fmt.Errorf("opus encode failed: %w", err)
+	}
+	return e.packet[:n], nil
+}
+
+// parseBitrate converts an FFmpeg style bitrate ("128k", "96000") to bps.
+func parseBitrate(s string) (int, error) {
+	if s == "" {
+		return 128000, nil
+	}
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier = 1000
+		s = s[:len(s)-1]
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1000000
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -3,20 +3,23 @@ package stream
 import (
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os/exec"
 	"strings"
+	"sync/atomic"
 
 	"VLX_AudioBridge/internal/config"
 )
 
 type FFmpegProcess struct {
+	log       *slog.Logger
 	cmd       *exec.Cmd
 	stdin     io.WriteCloser
-	isRunning bool
+	isRunning atomic.Bool // Cleared by the Wait goroutine, read by the writer and health checks
 }
 
-func NewFFmpegProcess(cfg config.StreamingConfig) (*FFmpegProcess, error) {
+// NewFFmpegProcess prepares an FFmpeg process encoding the mix to Opus in MPEG-TS for cfg.URL.
+func NewFFmpegProcess(log *slog.Logger, cfg config.OutputConfig) (*FFmpegProcess, error) {
 	args := []string{
 		// Note: "-re" flag removed as the Go Mixer already dictates real-time timing.
 		"-f", "s16le",
@@ -33,13 +36,13 @@ func NewFFmpegProcess(cfg config.StreamingConfig) (*FFmpegProcess, error) {
 	}
 
 	// Append pkt_size to SRT destination for stability
-	destination := cfg.DestinationURL
+	destination := cfg.URL
 	if strings.HasPrefix(destination, "srt://") && !strings.Contains(destination, "pkt_size") {
 		 destination += "&pkt_size=1316"
 	}
 	args = append(args, destination)
 
-	log.Printf("[INFO] [Stream]: FFmpeg command: ffmpeg %s", strings.Join(args, " "))
+	log.Info("FFmpeg command", "cmd", "ffmpeg "+strings.Join(args, " "))
 
 	// Set to nil for production cleanliness, or os.Stderr for debugging
 	cmd := exec.Command("ffmpeg", args...)
@@ -51,6 +54,7 @@ func NewFFmpegProcess(cfg config.StreamingConfig) (*FFmpegProcess, error) {
 	}
 
 	return &FFmpegProcess{
+		log:   log,
 		cmd:   cmd,
 		stdin: stdin,
 	}, nil
@@ -59,28 +63,33 @@ func NewFFmpegProcess(cfg config.StreamingConfig) (*FFmpegProcess, error) {
 // ... (Rest of the file remains unchanged as it was already correct) ...
 // (Mantieni Start, Write e Stop come sono)
 func (f *FFmpegProcess) Start() error {
-	if f.isRunning { return nil }
+	if f.isRunning.Load() { return nil }
 	if err := f.cmd.Start(); err != nil { return err }
-	f.isRunning = true
+	f.isRunning.Store(true)
 	go func() {
 		f.cmd.Wait()
-		f.isRunning = false
-		log.Println("[Stream] FFmpeg process terminated.")
+		f.isRunning.Store(false)
+		f.log.Info("FFmpeg process terminated.")
 	}()
 	return nil
 }
 
 func (f *FFmpegProcess) Write(pcmData []byte) (int, error) {
-	if !f.isRunning { return 0, fmt.Errorf("ffmpeg is not running") }
+	if !f.isRunning.Load() { return 0, fmt.Errorf("ffmpeg is not running") }
 	return f.stdin.Write(pcmData)
 }
 
+// Alive reports whether the FFmpeg process is still running.
+func (f *FFmpegProcess) Alive() bool {
+	return f.isRunning.Load()
+}
+
 func (f *FFmpegProcess) Stop() {
-	if f.isRunning {
+	if f.isRunning.Load() {
 		f.stdin.Close()
 		if f.cmd.Process != nil {
 			f.cmd.Process.Kill()
 		}
-		f.isRunning = false
+		f.isRunning.Store(false)
 	}
 }
@@ -0,0 +1,125 @@
+package stream
+
+import "encoding/binary"
+
+// Fragmented MP4 for a single Opus track, following "Encapsulation of Opus in
+// ISO Base Media File Format": an init segment with an "Opus" sample entry and
+// dOps box, then one moof/mdat fragment per media segment.
+
+const (
+	fmp4TrackID   = 1
+	fmp4Timescale = 48000
+)
+
+// fmp4Box builds a box from its type and payload parts.
+func fmp4Box(boxType string, parts ...[]byte) []byte {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, boxType...)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// fmp4FullBox builds a box with version and flags.
+func fmp4FullBox(boxType string, version byte, flags uint32, parts ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return fmp4Box(boxType, append([][]byte{header}, parts...)...)
+}
+
+func be16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func be64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+// Unity transformation matrix of mvhd and tkhd.
+var fmp4Matrix = []byte{
+	0x00, 0x01, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0x00, 0x01, 0x00, 0x00, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0x00, 0x00, 0x00,
+}
+
+// fmp4Init returns the initialization segment (ftyp + moov).
+func fmp4Init() []byte {
+	ftyp := fmp4Box("ftyp", []byte("iso6"), be32(0), []byte("iso6cmfcmp41"))
+
+	mvhd := fmp4FullBox("mvhd", 0, 0,
+		be32(0), be32(0), // Creation, modification time
+		be32(fmp4Timescale), be32(0), // Timescale, duration (fragmented)
+		be32(0x00010000), be16(0x0100), make([]byte, 10), // Rate, volume, reserved
+		fmp4Matrix, make([]byte, 24), // Matrix, pre_defined
+		be32(fmp4TrackID+1)) // next_track_ID
+
+	tkhd := fmp4FullBox("tkhd", 0, 0x000003, // Enabled, in movie
+		be32(0), be32(0), be32(fmp4TrackID), be32(0), be32(0),
+		make([]byte, 8), be16(0), be16(0), be16(0x0100), be16(0), // Reserved, layer, group, volume, reserved
+		fmp4Matrix, be32(0), be32(0)) // Matrix, width, height
+
+	mdhd := fmp4FullBox("mdhd", 0, 0,
+		be32(0), be32(0), be32(fmp4Timescale), be32(0),
+		be16(0x55c4), be16(0)) // Language "und"
+	hdlr := fmp4FullBox("hdlr", 0, 0,
+		be32(0), []byte("soun"), make([]byte, 12), []byte("SoundHandler\x00"))
+
+	dOps := fmp4Box("dOps",
+		[]byte{0, 2}, // Version, output channel count
+		be16(oggPreSkip), be32(48000),
+		be16(0), []byte{0}) // Output gain, channel mapping family 0
+	opus := fmp4Box("Opus",
+		make([]byte, 6), be16(1), // Reserved, data_reference_index
+		make([]byte, 8), be16(2), be16(16), // Reserved, channel count, sample size
+		be16(0), be16(0), be32(48000<<16), // pre_defined, reserved, sample rate (16.16)
+		dOps)
+	stbl := fmp4Box("stbl",
+		fmp4FullBox("stsd", 0, 0, be32(1), opus),
+		fmp4FullBox("stts", 0, 0, be32(0)),
+		fmp4FullBox("stsc", 0, 0, be32(0)),
+		fmp4FullBox("stsz", 0, 0, be32(0), be32(0)),
+		fmp4FullBox("stco", 0, 0, be32(0)))
+	dinf := fmp4Box("dinf", fmp4FullBox("dref", 0, 0, be32(1), fmp4FullBox("url ", 0, 1)))
+	minf := fmp4Box("minf", fmp4FullBox("smhd", 0, 0, be16(0), be16(0)), dinf, stbl)
+
+	trak := fmp4Box("trak", tkhd, fmp4Box("mdia", mdhd, hdlr, minf))
+	mvex := fmp4Box("mvex", fmp4FullBox("trex", 0, 0,
+		be32(fmp4TrackID), be32(1), be32(frameSamples), be32(0), be32(0)))
+
+	return append(ftyp, fmp4Box("moov", mvhd, trak, mvex)...)
+}
+
+// fmp4Fragment returns one media segment (moof + mdat) holding the packets,
+// each frameSamples long, starting at baseTime (48kHz).
+func fmp4Fragment(sequence uint32, baseTime uint64, packets [][]byte) []byte {
+	samples := make([]byte, 0, len(packets)*8)
+	mdatSize := 8
+	for _, p := range packets {
+		samples = binary.BigEndian.AppendUint32(samples, frameSamples)
+		samples = binary.BigEndian.AppendUint32(samples, uint32(len(p)))
+		mdatSize += len(p)
+	}
+
+	build := func(dataOffset uint32) []byte {
+		trun := fmp4FullBox("trun", 0, 0x000301, // Data offset, sample duration and size present
+			be32(uint32(len(packets))), be32(dataOffset), samples)
+		traf := fmp4Box("traf",
+			fmp4FullBox("tfhd", 0, 0x020000, be32(fmp4TrackID)), // default-base-is-moof
+			fmp4FullBox("tfdt", 1, 0, be64(baseTime)),
+			trun)
+		return fmp4Box("moof", fmp4FullBox("mfhd", 0, 0, be32(sequence)), traf)
+	}
+	// The data offset points past moof and the mdat header; moof's size doesn't depend on it
+	moof := build(0)
+	moof = build(uint32(len(moof) + 8))
+
+	segment := make([]byte, 0, len(moof)+mdatSize)
+	segment = append(segment, moof...)
+	segment = binary.BigEndian.AppendUint32(segment, uint32(mdatSize))
+	segment = append(segment, "mdat"...)
+	for _, p := range packets {
+		segment = append(segment, p...)
+	}
+	return segment
+}
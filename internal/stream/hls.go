@@ -0,0 +1,336 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+const (
+	hlsPlaylist       = "index.m3u8"
+	hlsInitSegment    = "init.mp4"
+	hlsDefaultSeconds = 4
+	hlsDefaultWindow  = 6
+	hlsKeepExtra      = 2 // Segments kept past the window for clients still fetching them
+)
+
+type hlsSegment struct {
+	name          string
+	duration      float64
+	discontinuity bool // First segment after a restart: timestamps start over
+}
+
+// HLSOutput writes the mix as rolling HLS (Opus in fMP4 segments and a live
+// playlist) to a directory, optionally served by the HTTP API. Opus in MPEG-TS
+// is left out on purpose: HLS players can't demux it.
+type HLSOutput struct {
+	log       *slog.Logger
+	config    config.OutputConfig
+	encoder   *frameEncoder
+	segFrames int
+	target    int // EXT-X-TARGETDURATION, constant for the whole run
+	window    int
+	runID     string // Segment name prefix, so restarts never reuse names
+	dir       string // Absolute directory, set while registered
+
+	frames   int
+	packets  [][]byte
+	baseTime uint64
+	sequence int // Media sequence number of the next segment, carried over restarts
+	segments []hlsSegment
+
+	discontinuities int  // Discontinuities dropped from segments, for EXT-X-DISCONTINUITY-SEQUENCE
+	restarted       bool // The next segment follows an earlier run's segments
+}
+
+// NewHLSOutput prepares an HLS writer for cfg.Directory. Nothing is written until Start.
+func NewHLSOutput(log *slog.Logger, cfg config.OutputConfig) (*HLSOutput, error) {
+	encoder, err := newFrameEncoder(cfg.Bitrate)
+	if err != nil {
+		return nil, err
+	}
+	seconds := cfg.SegmentSeconds
+	if seconds == 0 {
+		seconds = hlsDefaultSeconds
+	}
+	window := cfg.Window
+	if window == 0 {
+		window = hlsDefaultWindow
+	}
+	return &HLSOutput{
+		log:       log,
+		config:    cfg,
+		encoder:   encoder,
+		segFrames: seconds * int(time.Second/frameDuration),
+		target:    seconds,
+		window:    window,
+	}, nil
+}
+
+// Start claims the directory, clears what a previous run left and registers the mount for serving.
+func (o *HLSOutput) Start() error {
+	if err := os.MkdirAll(o.config.Directory, 0755); err != nil {
+		return fmt.Errorf("failed to create HLS directory: %w", err)
+	}
+	// Before touching any file: another output would delete or overwrite ours
+	if err := o.register(); err != nil {
+		return err
+	}
+	o.runID = time.Now().UTC().Format("20060102T150405")
+	// Continue the previous run's playlist, so players never see the sequence go back
+	o.resume()
+	o.removeStale()
+	if err := writeFileAtomic(filepath.Join(o.config.Directory, hlsInitSegment), fmp4Init()); err != nil {
+		return err
+	}
+	o.log.Info("HLS output started", "dir", o.config.Directory, "mount", o.config.Mount, "segment_frames", o.segFrames)
+	return nil
+}
+
+// resume picks up the media sequence and the segments still on disk from the
+// playlist of a previous run. The first new segment is marked as a discontinuity.
+func (o *HLSOutput) resume() {
+	f, err := os.Open(filepath.Join(o.config.Directory, hlsPlaylist))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sequence, discontinuities := 0, 0
+	var segments []hlsSegment
+	var next hlsSegment
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			discontinuities, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"))
+		case line == "#EXT-X-DISCONTINUITY":
+			next.discontinuity = true
+		case strings.HasPrefix(line, "#EXTINF:"):
+			next.duration, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(line, "#EXTINF:"), ","), 64)
+		case line != "" && !strings.HasPrefix(line, "#"):
+			next.name = line
+			segments = append(segments, next)
+			next = hlsSegment{}
+		}
+	}
+
+	// Only a contiguous run of segments still on disk can be listed again
+	o.sequence = sequence + len(segments)
+	o.discontinuities = discontinuities
+	for i := len(segments) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(o.config.Directory, segments[i].name)); err != nil {
+			for _, s := range segments[:i+1] {
+				if s.discontinuity {
+					o.discontinuities++
+				}
+			}
+			segments = segments[i+1:]
+			break
+		}
+	}
+	o.segments = segments
+	o.restarted = len(segments) > 0
+	// Segments are never longer than segment_seconds, except resumed ones of a longer setting
+	for _, s := range segments {
+		o.target = max(o.target, int(math.Ceil(s.duration)))
+	}
+}
+
+// removeStale deletes segments left by a previous run that its playlist no longer lists.
+func (o *HLSOutput) removeStale() {
+	if o.config.Archive {
+		return
+	}
+	listed := make(map[string]bool, len(o.segments))
+	for _, s := range o.segments {
+		listed[s.name] = true
+	}
+	entries, err := os.ReadDir(o.config.Directory)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".m4s") && !listed[name] {
+			os.Remove(filepath.Join(o.config.Directory, name))
+		}
+	}
+}
+
+// Write encodes one 20ms frame and closes a segment every segment_seconds.
+func (o *HLSOutput) Write(pcmData []byte) (int, error) {
+	packet, err := o.encoder.encode(pcmData)
+	if err != nil {
+		return 0, err
+	}
+	o.packets = append(o.packets, append([]byte(nil), packet...))
+	o.frames++
+	if o.frames == o.segFrames {
+		if err := o.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(pcmData), nil
+}
+
+// flush writes the pending segment and the updated playlist.
+func (o *HLSOutput) flush() error {
+	if o.frames == 0 {
+		return nil
+	}
+	name := fmt.Sprintf("%s_%06d.m4s", o.runID, o.sequence)
+	data := fmp4Fragment(uint32(o.sequence+1), o.baseTime, o.packets)
+	o.baseTime += uint64(len(o.packets) * frameSamples)
+	if err := writeFileAtomic(filepath.Join(o.config.Directory, name), data); err != nil {
+		return err
+	}
+	o.segments = append(o.segments, hlsSegment{name: name, duration: float64(o.frames) * frameDuration.Seconds(), discontinuity: o.restarted})
+	o.sequence++
+	o.frames, o.packets, o.restarted = 0, nil, false
+
+	if !o.config.Archive && len(o.segments) > o.window+hlsKeepExtra {
+		drop := len(o.segments) - o.window - hlsKeepExtra
+		for _, s := range o.segments[:drop] {
+			os.Remove(filepath.Join(o.config.Directory, s.name))
+			if s.discontinuity {
+				o.discontinuities++
+			}
+		}
+		o.segments = o.segments[drop:]
+	}
+	return o.writePlaylist(false)
+}
+
+func (o *HLSOutput) writePlaylist(ended bool) error {
+	listed := o.segments
+	if !o.config.Archive && len(listed) > o.window {
+		listed = listed[len(listed)-o.window:]
+	}
+	discontinuities := o.discontinuities
+	for _, s := range o.segments[:len(o.segments)-len(listed)] {
+		if s.discontinuity {
+			discontinuities++
+		}
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:7\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", o.target)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", o.sequence-len(listed))
+	if discontinuities > 0 {
+		fmt.Fprintf(&b, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", discontinuities)
+	}
+	if o.config.Archive {
+		b.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	}
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", hlsInitSegment)
+	for _, s := range listed {
+		if s.discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.duration, s.name)
+	}
+	if ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return writeFileAtomic(filepath.Join(o.config.Directory, hlsPlaylist), []byte(b.String()))
+}
+
+// Alive is always true; write errors are returned by Write.
+func (o *HLSOutput) Alive() bool {
+	return true
+}
+
+// Stop writes the partial segment, ends the playlist and releases the directory.
+func (o *HLSOutput) Stop() {
+	defer o.unregister()
+	if o.runID == "" {
+		return
+	}
+	if err := o.flush(); err != nil {
+		o.log.Warn("Failed to write final HLS segment", "err", err)
+	}
+	if len(o.segments) > 0 {
+		if err := o.writePlaylist(true); err != nil {
+			o.log.Warn("Failed to end HLS playlist", "err", err)
+		}
+	}
+}
+
+// writeFileAtomic replaces a file so HTTP clients never read it half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// Running HLS outputs, keyed by absolute directory so no two outputs (of any
+// guild) write to the same one, and the directories served per mount.
+var (
+	hlsMutex  sync.Mutex
+	hlsDirs   = make(map[string]*HLSOutput)
+	hlsMounts = make(map[string]string) // Mount without the leading slash -> directory
+)
+
+// register claims the output's directory and mount, refusing ones in use by another output.
+func (o *HLSOutput) register() error {
+	dir, err := filepath.Abs(o.config.Directory)
+	if err != nil {
+		return fmt.Errorf("invalid HLS directory %s: %w", o.config.Directory, err)
+	}
+	hlsMutex.Lock()
+	defer hlsMutex.Unlock()
+	if other, ok := hlsDirs[dir]; ok && other != o {
+		return fmt.Errorf("HLS directory %s is already used by another output; give each output its own", o.config.Directory)
+	}
+	key := strings.TrimPrefix(o.config.Mount, "/")
+	if o.config.Mount != "" {
+		if other, ok := hlsMounts[key]; ok && other != o.config.Directory {
+			return fmt.Errorf("HLS mount %s is already served from %s", o.config.Mount, other)
+		}
+		hlsMounts[key] = o.config.Directory
+	}
+	hlsDirs[dir] = o
+	o.dir = dir
+	return nil
+}
+
+func (o *HLSOutput) unregister() {
+	hlsMutex.Lock()
+	defer hlsMutex.Unlock()
+	if o.dir == "" || hlsDirs[o.dir] != o {
+		return
+	}
+	delete(hlsDirs, o.dir)
+	key := strings.TrimPrefix(o.config.Mount, "/")
+	if o.config.Mount != "" && hlsMounts[key] == o.config.Directory {
+		delete(hlsMounts, key)
+	}
+	o.dir = ""
+}
+
+// HLSDirectory returns the directory of the running HLS output served at mount.
+func HLSDirectory(mount string) (string, bool) {
+	hlsMutex.Lock()
+	defer hlsMutex.Unlock()
+	dir, ok := hlsMounts[mount]
+	return dir, ok
+}
@@ -0,0 +1,280 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+type mp4Box struct {
+	typ     string
+	payload []byte
+}
+
+// parseBoxes splits data into boxes, failing on sizes that don't add up.
+func parseBoxes(t *testing.T, data []byte) []mp4Box {
+	t.Helper()
+	var boxes []mp4Box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("%d trailing bytes, too short for a box header", len(data))
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			t.Fatalf("box %q: size %d, %d bytes left", data[4:8], size, len(data))
+		}
+		boxes = append(boxes, mp4Box{typ: string(data[4:8]), payload: data[8:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findBox follows a path of box types, skipping the fields that precede the
+// children of stsd (full box header, entry count) and Opus (sample entry).
+func findBox(t *testing.T, data []byte, path ...string) []byte {
+	t.Helper()
+	for i, typ := range path {
+		var found []byte
+		for _, b := range parseBoxes(t, data) {
+			if b.typ == typ {
+				found = b.payload
+				break
+			}
+		}
+		if found == nil {
+			t.Fatalf("box %s not found", strings.Join(path[:i+1], "/"))
+		}
+		data = found
+		switch typ {
+		case "stsd":
+			data = data[8:] // Full box header, entry count
+		case "Opus":
+			data = data[28:] // Audio sample entry fields
+		}
+	}
+	return data
+}
+
+func boxTypes(t *testing.T, data []byte) string {
+	var types []string
+	for _, b := range parseBoxes(t, data) {
+		types = append(types, b.typ)
+	}
+	return strings.Join(types, ",")
+}
+
+func TestFMP4Init(t *testing.T) {
+	seg := fmp4Init()
+	if got := boxTypes(t, seg); got != "ftyp,moov" {
+		t.Fatalf("init segment boxes %s, want ftyp,moov", got)
+	}
+	if ftyp := findBox(t, seg, "ftyp"); string(ftyp[:4]) != "iso6" || !bytes.Contains(ftyp, []byte("cmfc")) {
+		t.Errorf("ftyp: major brand %q, want iso6 compatible with cmfc", ftyp[:4])
+	}
+	if got := boxTypes(t, findBox(t, seg, "moov")); got != "mvhd,trak,mvex" {
+		t.Errorf("moov children %s, want mvhd,trak,mvex", got)
+	}
+	if got := boxTypes(t, findBox(t, seg, "moov", "trak", "mdia", "minf", "stbl")); got != "stsd,stts,stsc,stsz,stco" {
+		t.Errorf("stbl children %s", got)
+	}
+
+	mvhd := findBox(t, seg, "moov", "mvhd")
+	if ts := binary.BigEndian.Uint32(mvhd[12:]); ts != fmp4Timescale {
+		t.Errorf("mvhd timescale %d, want %d", ts, fmp4Timescale)
+	}
+	mdhd := findBox(t, seg, "moov", "trak", "mdia", "mdhd")
+	if ts := binary.BigEndian.Uint32(mdhd[12:]); ts != fmp4Timescale {
+		t.Errorf("mdhd timescale %d, want %d", ts, fmp4Timescale)
+	}
+	if hdlr := findBox(t, seg, "moov", "trak", "mdia", "hdlr"); string(hdlr[8:12]) != "soun" {
+		t.Errorf("hdlr type %q, want soun", hdlr[8:12])
+	}
+
+	// Sample entry: stereo, 16 bit, 48kHz, with dOps matching the Ogg header
+	entry := findBox(t, seg, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+	boxes := parseBoxes(t, entry)
+	if len(boxes) != 1 || boxes[0].typ != "Opus" {
+		t.Fatalf("stsd entries %s, want a single Opus", boxTypes(t, entry))
+	}
+	opus := boxes[0].payload
+	if ref := binary.BigEndian.Uint16(opus[6:]); ref != 1 {
+		t.Errorf("data_reference_index %d, want 1", ref)
+	}
+	if ch, bits, rate := binary.BigEndian.Uint16(opus[16:]), binary.BigEndian.Uint16(opus[18:]), binary.BigEndian.Uint32(opus[24:]); ch != 2 || bits != 16 || rate != 48000<<16 {
+		t.Errorf("Opus entry: %d channels, %d bit, rate %#x", ch, bits, rate)
+	}
+	dOps := findBox(t, seg, "moov", "trak", "mdia", "minf", "stbl", "stsd", "Opus", "dOps")
+	want := []byte{0, 2, oggPreSkip >> 8, oggPreSkip & 0xff, 0x00, 0x00, 0xbb, 0x80, 0, 0, 0}
+	if !bytes.Equal(dOps, want) {
+		t.Errorf("dOps % x, want % x", dOps, want)
+	}
+
+	trex := findBox(t, seg, "moov", "mvex", "trex")
+	if id, duration := binary.BigEndian.Uint32(trex[4:]), binary.BigEndian.Uint32(trex[12:]); id != fmp4TrackID || duration != frameSamples {
+		t.Errorf("trex: track %d, default duration %d", id, duration)
+	}
+}
+
+func TestFMP4Fragment(t *testing.T) {
+	packets := [][]byte{
+		bytes.Repeat([]byte{1}, 120),
+		bytes.Repeat([]byte{2}, 3),
+		bytes.Repeat([]byte{3}, 300),
+	}
+	const sequence, baseTime = 7, 1 << 33 // Needs the 64 bit tfdt
+	segment := fmp4Fragment(sequence, baseTime, packets)
+	if got := boxTypes(t, segment); got != "moof,mdat" {
+		t.Fatalf("fragment boxes %s, want moof,mdat", got)
+	}
+
+	if mfhd := findBox(t, segment, "moof", "mfhd"); binary.BigEndian.Uint32(mfhd[4:]) != sequence {
+		t.Errorf("mfhd sequence %d, want %d", binary.BigEndian.Uint32(mfhd[4:]), sequence)
+	}
+	tfhd := findBox(t, segment, "moof", "traf", "tfhd")
+	if flags := binary.BigEndian.Uint32(tfhd) & 0xffffff; flags != 0x020000 || binary.BigEndian.Uint32(tfhd[4:]) != fmp4TrackID {
+		t.Errorf("tfhd flags %#x track %d, want default-base-is-moof for track %d", flags, binary.BigEndian.Uint32(tfhd[4:]), fmp4TrackID)
+	}
+	tfdt := findBox(t, segment, "moof", "traf", "tfdt")
+	if tfdt[0] != 1 || binary.BigEndian.Uint64(tfdt[4:]) != baseTime {
+		t.Errorf("tfdt version %d time %d, want version 1 time %d", tfdt[0], binary.BigEndian.Uint64(tfdt[4:]), uint64(baseTime))
+	}
+
+	trun := findBox(t, segment, "moof", "traf", "trun")
+	if count := binary.BigEndian.Uint32(trun[4:]); count != uint32(len(packets)) {
+		t.Fatalf("trun sample count %d, want %d", count, len(packets))
+	}
+	// The data offset is relative to moof and lands on the first sample in mdat
+	offset := int(binary.BigEndian.Uint32(trun[8:]))
+	data := segment[offset:]
+	for i, p := range packets {
+		duration := binary.BigEndian.Uint32(trun[12+i*8:])
+		size := int(binary.BigEndian.Uint32(trun[16+i*8:]))
+		if duration != frameSamples || size != len(p) {
+			t.Errorf("sample %d: duration %d size %d, want %d and %d", i, duration, size, frameSamples, len(p))
+		}
+		if !bytes.Equal(data[:size], p) {
+			t.Errorf("sample %d: data at the trun offset differs", i)
+		}
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		t.Errorf("%d bytes in mdat past the last sample", len(data))
+	}
+}
+
+// hlsRun starts an HLS output in dir, writes frames and stops it.
+func hlsRun(t *testing.T, cfg config.OutputConfig, frames int) {
+	t.Helper()
+	out, err := NewHLSOutput(testLogger(), cfg)
+	if err != nil {
+		t.Fatalf("NewHLSOutput: %v", err)
+	}
+	if err := out.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	frame := make([]byte, frameSamples*Channels*2)
+	for i := 0; i < frames; i++ {
+		if _, err := out.Write(frame); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	out.Stop()
+}
+
+func readPlaylist(t *testing.T, dir string) (tags map[string]string, segments []string, discontinuities []int) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, hlsPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags = make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		switch {
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuities = append(discontinuities, len(segments))
+		case strings.HasPrefix(line, "#"):
+			name, value, _ := strings.Cut(line, ":")
+			tags[name] = value
+		default:
+			segments = append(segments, line)
+			if _, err := os.Stat(filepath.Join(dir, line)); err != nil {
+				t.Errorf("listed segment %s missing on disk", line)
+			}
+		}
+	}
+	return tags, segments, discontinuities
+}
+
+func TestHLSRestartContinuesSequence(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.OutputConfig{Type: "hls", Directory: dir, SegmentSeconds: 1, Window: 3, Bitrate: "64k"}
+	perSegment := int(time.Second / frameDuration)
+
+	// 5 segments: 0..4, the window lists 2..4
+	hlsRun(t, cfg, 5*perSegment)
+	tags, segments, disc := readPlaylist(t, dir)
+	if tags["#EXT-X-MEDIA-SEQUENCE"] != "2" || len(segments) != 3 || len(disc) != 0 {
+		t.Fatalf("first run: sequence %s, %d segments, discontinuities %v", tags["#EXT-X-MEDIA-SEQUENCE"], len(segments), disc)
+	}
+	if _, ended := tags["#EXT-X-ENDLIST"]; !ended {
+		t.Error("first run: playlist not ended")
+	}
+
+	// 2 more segments (5, 6): the sequence goes on and the restart is a discontinuity
+	hlsRun(t, cfg, 2*perSegment)
+	tags, segments, disc = readPlaylist(t, dir)
+	if tags["#EXT-X-MEDIA-SEQUENCE"] != "4" || len(segments) != 3 {
+		t.Errorf("second run: sequence %s, %d segments, want 4 and 3", tags["#EXT-X-MEDIA-SEQUENCE"], len(segments))
+	}
+	if len(disc) != 1 || disc[0] != 1 {
+		t.Errorf("second run: discontinuities before segments %v, want [1]", disc)
+	}
+	if tags["#EXT-X-DISCONTINUITY-SEQUENCE"] != "" {
+		t.Errorf("second run: discontinuity sequence %s while the tag is listed", tags["#EXT-X-DISCONTINUITY-SEQUENCE"])
+	}
+
+	// 3 more (7..9): the discontinuity leaves the window and is counted instead
+	hlsRun(t, cfg, 3*perSegment)
+	tags, _, disc = readPlaylist(t, dir)
+	if tags["#EXT-X-MEDIA-SEQUENCE"] != "7" || len(disc) != 1 || disc[0] != 0 {
+		t.Errorf("third run: sequence %s, discontinuities %v, want 7 and [0]", tags["#EXT-X-MEDIA-SEQUENCE"], disc)
+	}
+	if tags["#EXT-X-DISCONTINUITY-SEQUENCE"] != "1" {
+		t.Errorf("third run: discontinuity sequence %q, want 1", tags["#EXT-X-DISCONTINUITY-SEQUENCE"])
+	}
+
+	// Files neither listed nor kept for slow clients are gone
+	m4s, _ := filepath.Glob(filepath.Join(dir, "*.m4s"))
+	if len(m4s) > cfg.Window+hlsKeepExtra {
+		t.Errorf("%d segments on disk, want at most %d", len(m4s), cfg.Window+hlsKeepExtra)
+	}
+}
+
+func TestHLSArchiveRestartKeepsSegments(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.OutputConfig{Type: "hls", Directory: dir, SegmentSeconds: 1, Archive: true, Bitrate: "64k"}
+	perSegment := int(time.Second / frameDuration)
+
+	hlsRun(t, cfg, 3*perSegment)
+	_, first, _ := readPlaylist(t, dir)
+	hlsRun(t, cfg, 2*perSegment)
+	tags, segments, disc := readPlaylist(t, dir)
+	if tags["#EXT-X-MEDIA-SEQUENCE"] != "0" || len(segments) != 5 {
+		t.Fatalf("archive restart: sequence %s, %d segments, want 0 and 5", tags["#EXT-X-MEDIA-SEQUENCE"], len(segments))
+	}
+	if strings.Join(segments[:3], ",") != strings.Join(first, ",") {
+		t.Errorf("archive restart: earlier segments %v, want %v", segments[:3], first)
+	}
+	if len(disc) != 1 || disc[0] != 3 {
+		t.Errorf("archive restart: discontinuities before %v, want [3]", disc)
+	}
+	if tags["#EXT-X-PLAYLIST-TYPE"] != "EVENT" {
+		t.Errorf("archive restart: playlist type %q", tags["#EXT-X-PLAYLIST-TYPE"])
+	}
+}
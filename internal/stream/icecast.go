@@ -0,0 +1,310 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+const (
+	icecastDialTimeout  = 10 * time.Second
+	icecastWriteTimeout = 5 * time.Second // A stalled server counts as a failure
+)
+
+// IcecastOutput connects as an Icecast source and streams Ogg/Opus (encoded
+// in-process) or MP3 (encoded by FFmpeg) to a mount point.
+type IcecastOutput struct {
+	log      *slog.Logger
+	config   config.OutputConfig
+	server   *url.URL
+	username string
+	conn     net.Conn
+	failed   atomic.Bool
+
+	// Ogg/Opus
+	encoder *frameEncoder
+	ogg     *oggOpusWriter
+
+	// MP3
+	ffmpeg *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// NewIcecastOutput prepares an Icecast source for cfg.URL and cfg.Mount. Nothing is sent until Start.
+func NewIcecastOutput(log *slog.Logger, cfg config.OutputConfig) (*IcecastOutput, error) {
+	server, err := url.Parse(cfg.URL)
+	if err != nil || (server.Scheme != "http" && server.Scheme != "https") || server.Host == "" {
+		return nil, fmt.Errorf("invalid Icecast server URL %q", cfg.URL)
+	}
+	if server.Port() == "" {
+		port := "8000"
+		if server.Scheme == "https" {
+			port = "443"
+		}
+		server.Host = net.JoinHostPort(server.Hostname(), port)
+	}
+	username := cfg.Username
+	if username == "" {
+		username = "source"
+	}
+	o := &IcecastOutput{
+		log:      log,
+		config:   cfg,
+		server:   server,
+		username: username,
+	}
+	if cfg.Format != config.FormatMP3 {
+		if o.encoder, err = newFrameEncoder(cfg.Bitrate); err != nil {
+			return nil, err
+		}
+		o.ogg = newOggOpusWriter(cfg.Title)
+	}
+	return o, nil
+}
+
+// Start authenticates as the mount's source and, for MP3, starts the encoder.
+func (o *IcecastOutput) Start() error {
+	conn, err := o.dial()
+	if err != nil {
+		return err
+	}
+	o.conn = conn
+	reader := bufio.NewReader(conn)
+	if err := o.handshake(reader); err != nil {
+		return err
+	}
+	// Only once the mount is ours: the goroutine below reaps the encoder, so an
+	// encoder started before a failed handshake would be left a zombie
+	if o.config.Format == config.FormatMP3 {
+		if err := o.startMP3Encoder(); err != nil {
+			return err
+		}
+	}
+
+	// Icecast sends nothing after accepting the source; EOF means it dropped us
+	go func() {
+		io.Copy(io.Discard, reader)
+		if o.failed.CompareAndSwap(false, true) {
+			o.log.Warn("Icecast server closed the connection")
+		}
+	}()
+	if o.ffmpeg != nil {
+		go func() {
+			_, err := io.Copy(deadlineWriter{conn}, o.stdout)
+			o.ffmpeg.Wait()
+			if o.failed.CompareAndSwap(false, true) {
+				o.log.Warn("MP3 stream ended", "err", err)
+			}
+		}()
+	}
+	o.log.Info("Icecast source connected", "mount", o.config.Mount, "format", o.format())
+	return nil
+}
+
+func (o *IcecastOutput) format() string {
+	if o.config.Format == config.FormatMP3 {
+		return config.FormatMP3
+	}
+	return config.FormatOpus
+}
+
+func (o *IcecastOutput) dial() (net.Conn, error) {
+	host := o.server.Host
+	dialer := &net.Dialer{Timeout: icecastDialTimeout}
+	var conn net.Conn
+	var err error
+	if o.server.Scheme == "https" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: o.server.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Icecast connect to %s failed: %w", host, err)
+	}
+	return conn, nil
+}
+
+// handshake sends the source request and waits for the server to accept the mount.
+func (o *IcecastOutput) handshake(reader *bufio.Reader) error {
+	contentType := "audio/ogg"
+	if o.config.Format == config.FormatMP3 {
+		contentType = "audio/mpeg"
+	}
+	bps, err := parseBitrate(o.config.Bitrate)
+	if err != nil {
+		return err
+	}
+	public := "0"
+	if o.config.Public {
+		public = "1"
+	}
+
+	var req strings.Builder
+	if o.config.Protocol == config.ProtocolSOURCE {
+		fmt.Fprintf(&req, "SOURCE %s HTTP/1.0\r\n", o.config.Mount)
+	} else {
+		// No Content-Length or chunking: the body is the stream itself
+		fmt.Fprintf(&req, "PUT %s HTTP/1.1\r\n", o.config.Mount)
+	}
+	fmt.Fprintf(&req, "Host: %s\r\n", o.server.Host)
+	fmt.Fprintf(&req, "Authorization: Basic %s\r\n", o.basicAuth())
+	fmt.Fprintf(&req, "User-Agent: VLX_AudioBridge\r\n")
+	fmt.Fprintf(&req, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&req, "Ice-Public: %s\r\n", public)
+	fmt.Fprintf(&req, "Ice-Audio-Info: samplerate=48000;channels=2;bitrate=%d\r\n", bps/1000)
+	if o.config.StreamName != "" {
+		fmt.Fprintf(&req, "Ice-Name: %s\r\n", headerValue(o.config.StreamName))
+	}
+	if o.config.Description != "" {
+		fmt.Fprintf(&req, "Ice-Description: %s\r\n", headerValue(o.config.Description))
+	}
+	req.WriteString("\r\n")
+
+	o.conn.SetDeadline(time.Now().Add(icecastDialTimeout))
+	defer o.conn.SetDeadline(time.Time{})
+	if _, err := io.WriteString(o.conn, req.String()); err != nil {
+		return fmt.Errorf("Icecast request failed: %w", err)
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return fmt.Errorf("Icecast response failed: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("Icecast rejected the source credentials for %s", o.config.Mount)
+	default:
+		// e.g. 403 when the mount is already in use
+		return fmt.Errorf("Icecast refused mount %s: %s", o.config.Mount, resp.Status)
+	}
+}
+
+func (o *IcecastOutput) basicAuth() string {
+	return base64.StdEncoding.EncodeToString([]byte(o.username + ":" + o.config.Password))
+}
+
+func (o *IcecastOutput) startMP3Encoder() error {
+	bitrate := o.config.Bitrate
+	if bitrate == "" {
+		bitrate = "128k"
+	}
+	cmd := exec.Command("ffmpeg",
+		"-f", "s16le", "-ar", "48000", "-ac", "2", "-i", "pipe:0",
+		"-c:a", "libmp3lame", "-b:a", bitrate,
+		"-f", "mp3", "pipe:1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ffmpeg stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ffmpeg stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	o.ffmpeg, o.stdin, o.stdout = cmd, stdin, stdout
+	return nil
+}
+
+// Write sends one 20ms PCM frame: muxed to Ogg/Opus, or piped to the MP3 encoder.
+func (o *IcecastOutput) Write(pcmData []byte) (int, error) {
+	if o.stdin != nil {
+		return o.stdin.Write(pcmData)
+	}
+	packet, err := o.encoder.encode(pcmData)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := (deadlineWriter{o.conn}).Write(o.ogg.write(packet)); err != nil {
+		o.failed.Store(true)
+		return 0, fmt.Errorf("Icecast write failed: %w", err)
+	}
+	return len(pcmData), nil
+}
+
+// SetMetadata updates the stream title: a chained Ogg stream for Opus, the
+// admin metadata endpoint for MP3.
+func (o *IcecastOutput) SetMetadata(title string) {
+	if o.ogg != nil {
+		o.ogg.setTitle(title)
+		return
+	}
+	go o.updateMP3Metadata(title)
+}
+
+func (o *IcecastOutput) updateMP3Metadata(title string) {
+	query := url.Values{
+		"mount":   {o.config.Mount},
+		"mode":    {"updinfo"},
+		"song":    {title},
+		"charset": {"UTF-8"},
+	}
+	endpoint := *o.server
+	endpoint.Path = "/admin/metadata"
+	endpoint.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Basic "+o.basicAuth())
+	client := &http.Client{Timeout: icecastDialTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		o.log.Warn("Icecast metadata update failed", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		o.log.Warn("Icecast metadata update failed", "status", resp.Status)
+		return
+	}
+	o.log.Debug("Icecast metadata updated", "title", title)
+}
+
+// Alive reports false once the connection or the MP3 encoder failed.
+func (o *IcecastOutput) Alive() bool {
+	return !o.failed.Load()
+}
+
+func (o *IcecastOutput) Stop() {
+	o.failed.Store(true)
+	if o.stdin != nil {
+		o.stdin.Close()
+	}
+	if o.ffmpeg != nil && o.ffmpeg.Process != nil {
+		o.ffmpeg.Process.Kill()
+	}
+	if o.conn != nil {
+		o.conn.Close()
+	}
+}
+
+// deadlineWriter fails writes to a connection that stops draining.
+type deadlineWriter struct {
+	conn net.Conn
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(icecastWriteTimeout))
+	return w.conn.Write(p)
+}
+
+// headerValue strips line breaks from configured header values.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,62 @@
+package stream
+
+import "VLX_AudioBridge/internal/metrics"
+
+// Level is a meter reading in dBFS (peak with hold/decay, RMS with VU smoothing).
+type Level struct {
+	PeakDB float64 `json:"peak_db"`
+	RMSDB  float64 `json:"rms_db"`
+}
+
+// SilentLevel is the reading of a meter without signal.
+var SilentLevel = Level{PeakDB: metrics.DBFS(0), RMSDB: metrics.DBFS(0)}
+
+// UserLevel is the live level of one speaker together with its mix settings.
+type UserLevel struct {
+	SSRC uint32 `json:"ssrc"`
+	Name string `json:"name,omitempty"` // Display name, filled in by the bot
+	UserSettings
+	Level
+}
+
+// Levels is a snapshot of the egress meters of a manager.
+type Levels struct {
+	Master Level       `json:"master"`
+	Users  []UserLevel `json:"users"`
+}
+
+func meterLevel(m *metrics.Meter) Level {
+	return Level{PeakDB: m.PeakDB(), RMSDB: m.RMSDB()}
+}
+
+// Levels returns the master and per-speaker meters. Muted and excluded users are listed
+// with a silent level so they can still be controlled.
+func (m *Manager) Levels() Levels {
+	mixer := m.mixer.Levels()
+	levels := Levels{Master: mixer.Master}
+
+	settings := make(map[string]UserSettings)
+	for _, us := range m.Users() {
+		settings[us.UserID] = us
+	}
+
+	m.usersMutex.Lock()
+	listed := make(map[string]bool)
+	for ssrc, level := range mixer.Sources {
+		userID := m.ssrcUsers[ssrc]
+		us, ok := settings[userID]
+		if !ok {
+			us = UserSettings{UserID: userID, Volume: 1}
+		}
+		listed[userID] = true
+		levels.Users = append(levels.Users, UserLevel{SSRC: ssrc, UserSettings: us, Level: level})
+	}
+	m.usersMutex.Unlock()
+
+	for userID, us := range settings {
+		if !listed[userID] {
+			levels.Users = append(levels.Users, UserLevel{UserSettings: us, Level: SilentLevel})
+		}
+	}
+	return levels
+}
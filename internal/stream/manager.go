@@ -1,77 +1,215 @@
 package stream
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/hraban/opus"
 	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
+	"VLX_AudioBridge/internal/metrics"
 )
 
 type Manager struct {
+	guildID       string
+	log           *slog.Logger
 	config        config.StreamingConfig
-	ffmpeg        *FFmpegProcess
 	mixer         *Mixer
 	opusDecoders  map[uint32]*opus.Decoder
 	excludedUsers map[string]bool
-	stopChan      chan struct{}
+
+	// Lifecycle: Open/Close run the mix tick (meters, replay buffer) for as long as
+	// the bridge is in voice, Start/Stop the outputs fed by it. Both are serialized by
+	// lifecycleMutex (Stop waits for the outputs), stateMutex guards the fields read
+	// by the fan-out, Running and DeadOutputs
+	lifecycleMutex sync.Mutex
+	stateMutex     sync.Mutex
+	mixStop        chan struct{}
+	outputs        []*outputRunner
+	outputsWG      sync.WaitGroup
+	stopChan       chan struct{}
+
+	// SSRC -> user mapping and per-user mix settings
+	usersMutex  sync.Mutex
+	ssrcUsers   map[uint32]string
+	userVolumes map[string]float64
+	mutedUsers  map[string]bool
+
+	// Stream metadata (Icecast titles)
+	metaMutex   sync.Mutex
+	title       string
+	resolveName func(userID string) string
 }
 
-func NewManager(cfg config.StreamingConfig) *Manager {
+func NewManager(guildID string, cfg config.StreamingConfig) *Manager {
 	exMap := make(map[string]bool)
 	for _, id := range cfg.ExcludedUsers {
 		exMap[id] = true
 	}
 
+	mixer := NewMixer(guildID)
+	if minutes := cfg.Replay.Minutes; minutes >= 0 {
+		if minutes == 0 {
+			minutes = replayDefaultMinutes
+		}
+		mixer.replay = newReplayBuffer(minutes, cfg.Replay.PerUser)
+	}
+
 	return &Manager{
+		guildID:       guildID,
+		log:           logging.For(logging.Stream).With("guild", guildID),
 		config:        cfg,
-		mixer:         NewMixer(),
+		mixer:         mixer,
 		opusDecoders:  make(map[uint32]*opus.Decoder),
 		excludedUsers: exMap,
-		stopChan:      make(chan struct{}),
+		ssrcUsers:     make(map[uint32]string),
+		userVolumes:   make(map[string]float64),
+		mutedUsers:    make(map[string]bool),
 	}
 }
 
-func (m *Manager) Start() error {
-	var err error
-	m.ffmpeg, err = NewFFmpegProcess(m.config)
-	if err != nil {
-		return err
-	}
-	if err := m.ffmpeg.Start(); err != nil {
-		return err
+// Open starts the mix tick, which feeds the meters, the replay buffer and the
+// running outputs. It is a no-op if already open.
+func (m *Manager) Open() {
+	m.lifecycleMutex.Lock()
+	defer m.lifecycleMutex.Unlock()
+	m.openLocked()
+}
+
+func (m *Manager) openLocked() {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+	if m.mixStop != nil {
+		return
 	}
-	go m.mixer.StartMixing(m.stopChan)
+	mixStop := make(chan struct{})
+	m.mixStop = mixStop
+	go m.mixer.StartMixing(mixStop)
 	go func() {
+		// Every output gets the same frame; outputs only read it
 		for {
 			select {
 			case data := <-m.mixer.mixedOut:
-				if _, err := m.ffmpeg.Write(data); err != nil {
-					log.Println("[Stream] Error writing to FFmpeg pipe:", err)
-					return
+				m.stateMutex.Lock()
+				runners := m.outputs
+				m.stateMutex.Unlock()
+				for _, r := range runners {
+					r.send(data)
 				}
-			case <-m.stopChan:
+			case <-mixStop:
 				return
 			}
 		}
 	}()
+}
+
+// Close stops the outputs and the mix tick.
+func (m *Manager) Close() {
+	m.Stop()
+	m.lifecycleMutex.Lock()
+	defer m.lifecycleMutex.Unlock()
+	m.stateMutex.Lock()
+	mixStop := m.mixStop
+	m.mixStop = nil
+	m.stateMutex.Unlock()
+	if mixStop != nil {
+		close(mixStop)
+	}
+}
+
+// Start starts the outputs, opening the mix tick if needed.
+func (m *Manager) Start() error {
+	outputs := m.config.OutputList()
+	if len(outputs) == 0 {
+		return fmt.Errorf("no stream outputs configured")
+	}
+	m.lifecycleMutex.Lock()
+	defer m.lifecycleMutex.Unlock()
+	if m.Running() {
+		return fmt.Errorf("output already running")
+	}
+	m.openLocked()
+
+	// Fresh stop channel so the manager can be restarted after Stop
+	stopChan := make(chan struct{})
+	runners := make([]*outputRunner, len(outputs))
+	for i, cfg := range outputs {
+		runner := newOutputRunner(m.guildID, m.log, i, cfg)
+		runners[i] = runner
+		m.outputsWG.Add(1)
+		go func() {
+			defer m.outputsWG.Done()
+			runner.run(stopChan)
+		}()
+	}
+	m.stateMutex.Lock()
+	m.stopChan, m.outputs = stopChan, runners
+	m.stateMutex.Unlock()
+	for _, r := range runners {
+		if r.config.Metadata != "" {
+			go m.runMetadata(runners, stopChan)
+			break
+		}
+	}
 	return nil
 }
 
+// Stop stops the outputs; the mix tick keeps running until Close.
 func (m *Manager) Stop() {
-	close(m.stopChan)
-	if m.ffmpeg != nil {
-		m.ffmpeg.Stop()
+	m.lifecycleMutex.Lock()
+	defer m.lifecycleMutex.Unlock()
+	m.stateMutex.Lock()
+	stopChan := m.stopChan
+	m.stopChan, m.outputs = nil, nil
+	m.stateMutex.Unlock()
+	if stopChan != nil {
+		close(stopChan)
 	}
+	// Outputs close their sessions (e.g. WHIP DELETE) before returning
+	m.outputsWG.Wait()
+}
+
+// Running reports whether the output is started.
+func (m *Manager) Running() bool {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+	return m.stopChan != nil
+}
+
+// DeadOutputs returns the names of started outputs that are currently down and retrying.
+func (m *Manager) DeadOutputs() []string {
+	m.stateMutex.Lock()
+	runners := m.outputs
+	m.stateMutex.Unlock()
+	var dead []string
+	for _, r := range runners {
+		if !r.alive.Load() {
+			dead = append(dead, r.name)
+		}
+	}
+	return dead
 }
 
 func (m *Manager) HandlePacket(p *discordgo.Packet) {
+	// Excluded and muted users never reach the mixer
+	userID, gain, drop := m.userGain(p.SSRC)
+	if userID == "" {
+		// No speaking update yet; SSRCs change per connection, so don't label by them
+		userID = "unknown"
+	}
+	metrics.PacketsReceived.WithLabelValues(m.guildID, userID).Inc()
+	if drop {
+		return
+	}
+
 	decoder, exists := m.opusDecoders[p.SSRC]
 	if !exists {
 		var err error
 		decoder, err = opus.NewDecoder(48000, 2)
 		if err != nil {
-			log.Println("[Stream] Error creating Opus decoder:", err)
+			m.log.Error("Error creating Opus decoder", "ssrc", p.SSRC, "user", userID, "err", err)
 			return
 		}
 		m.opusDecoders[p.SSRC] = decoder
@@ -83,17 +221,28 @@ func (m *Manager) HandlePacket(p *discordgo.Packet) {
 	
 	n, err := decoder.Decode(p.Opus, pcmBuffer)
 	if err != nil {
+		metrics.PacketsFailed.WithLabelValues(m.guildID, userID).Inc()
 		// Log only critical errors, ignore occasional 'corrupted stream' which is expected on UDP
 		if err.Error() != "opus: corrupted stream" {
-			log.Printf("[Stream] Decode Error for SSRC %d: %v", p.SSRC, err)
+			m.log.Warn("Decode error", "ssrc", p.SSRC, "user", userID, "err", err)
 		}
 		return
 	}
 
+	if gain != 1 {
+		applyGain(pcmBuffer[:n*2], gain)
+	}
+
 	// Pass decoded PCM to mixer
 	m.mixer.AddFrame(p.SSRC, pcmBuffer[:n*2])
+	metrics.PacketsDecoded.WithLabelValues(m.guildID, userID).Inc()
 }
 
-func (m *Manager) SetUserSSRC(ssrc uint32, userID string) {
-    // Placeholder for future SSRC-UserID mapping logic
+// LocalSSRC is the mixer slot used for audio generated by the bridge itself (e.g. soundboard clips).
+const LocalSSRC uint32 = 0
+
+// InjectFrame mixes locally generated PCM (interleaved 48kHz stereo) into the stream.
+func (m *Manager) InjectFrame(pcm []int16) {
+	m.mixer.AddFrame(LocalSSRC, pcm)
 }
+
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+const (
+	metadataInterval   = time.Second
+	speakerThresholdDB = -40.0 // RMS level above which a user counts as speaking
+)
+
+// SetNameResolver sets how user IDs are shown as the current speaker.
+func (m *Manager) SetNameResolver(resolve func(userID string) string) {
+	m.metaMutex.Lock()
+	defer m.metaMutex.Unlock()
+	m.resolveName = resolve
+}
+
+// SetTitle overrides the configured show title of every output; "" restores it.
+func (m *Manager) SetTitle(title string) {
+	m.metaMutex.Lock()
+	defer m.metaMutex.Unlock()
+	m.title = title
+}
+
+// Title returns the show title set at runtime, "" if the configured ones apply.
+func (m *Manager) Title() string {
+	m.metaMutex.Lock()
+	defer m.metaMutex.Unlock()
+	return m.title
+}
+
+// runMetadata keeps the title of outputs with metadata enabled up to date.
+func (m *Manager) runMetadata(runners []*outputRunner, stop <-chan struct{}) {
+	ticker := time.NewTicker(metadataInterval)
+	defer ticker.Stop()
+	speaker := ""
+	for {
+		// The last speaker stays until someone else talks, so pauses don't flap the title
+		if name := m.loudestSpeaker(); name != "" {
+			speaker = name
+		}
+		title := m.Title()
+		for _, r := range runners {
+			t := title
+			if t == "" {
+				t = r.config.Title
+			}
+			switch r.config.Metadata {
+			case config.MetadataSpeaker:
+				if speaker != "" {
+					t = speaker
+				}
+			case config.MetadataTitle:
+			default:
+				continue
+			}
+			r.setMetadata(t)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loudestSpeaker returns the name of the loudest user above the speaking threshold.
+func (m *Manager) loudestSpeaker() string {
+	best, bestDB := "", speakerThresholdDB
+	for _, u := range m.Levels().Users {
+		if u.UserID != "" && !u.Muted && !u.Excluded && u.RMSDB > bestDB {
+			best, bestDB = u.UserID, u.RMSDB
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	m.metaMutex.Lock()
+	resolve := m.resolveName
+	m.metaMutex.Unlock()
+	if resolve != nil {
+		if name := resolve(best); name != "" {
+			return name
+		}
+	}
+	return best
+}
@@ -5,6 +5,9 @@ import (
 	"math"
 	"sync"
 	"time"
+
+	"VLX_AudioBridge/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -12,19 +15,42 @@ const (
 	Channels     = 2
 	FrameSize    = 960 // 20ms at 48kHz
 	MaxBufferLen = 50  // Jitter buffer size
+
+	// Sources silent for this many ticks (5s) are dropped. Discord assigns a new
+	// SSRC on every rejoin, so they would otherwise pile up in the meters.
+	sourceIdleTicks = 250
 )
 
 type Mixer struct {
 	userBuffers map[uint32][][]int16
 	mutex       sync.Mutex
 	mixedOut    chan []byte
+	replay      *replayBuffer // Instant replay recording, nil when disabled
+
+	// Live meters for the dashboard, guarded by mutex
+	master    metrics.Meter
+	sources   map[uint32]*metrics.Meter
+	idleTicks map[uint32]int // Consecutive ticks without a frame, per source
+
+	// Metrics, bound to the guild label
+	bufferDepth prometheus.Gauge
+	dropped     prometheus.Counter
+	peakLevel   prometheus.Gauge
+	rmsLevel    prometheus.Gauge
 }
 
-func NewMixer() *Mixer {
+func NewMixer(guildID string) *Mixer {
 	return &Mixer{
 		userBuffers: make(map[uint32][][]int16),
 		// Low latency optimization: 10 packets buffer (approx. 200ms) to ensure responsiveness
-		mixedOut: make(chan []byte, 10),
+		mixedOut:  make(chan []byte, 10),
+		sources:   make(map[uint32]*metrics.Meter),
+		idleTicks: make(map[uint32]int),
+
+		bufferDepth: metrics.JitterBufferDepth.WithLabelValues(guildID),
+		dropped:     metrics.MixerFramesDropped.WithLabelValues(guildID),
+		peakLevel:   metrics.PeakLevel.WithLabelValues(guildID, metrics.DirectionEgress),
+		rmsLevel:    metrics.RMSLevel.WithLabelValues(guildID, metrics.DirectionEgress),
 	}
 }
 
@@ -77,9 +103,22 @@ func (m *Mixer) mixTick(out []int16) {
 	}
 
 	// 2. Mix samples from all active users
+	depth := 0
 	for ssrc, frames := range m.userBuffers {
+		if len(frames) > depth {
+			depth = len(frames)
+		}
+		sourceMeter, ok := m.sources[ssrc]
+		if !ok {
+			sourceMeter = new(metrics.Meter)
+			m.sources[ssrc] = sourceMeter
+		}
 		if len(frames) > 0 {
 			currentFrame := frames[0]
+			sourceMeter.Update(frameLevel(currentFrame))
+			if m.replay != nil {
+				m.replay.addSource(ssrc, currentFrame)
+			}
 			
 			for i := 0; i < len(out) && i < len(currentFrame); i++ {
 				// Summing samples
@@ -100,10 +139,30 @@ func (m *Mixer) mixTick(out []int16) {
 			}
 			// Dequeue processed frame
 			m.userBuffers[ssrc] = m.userBuffers[ssrc][1:]
+			delete(m.idleTicks, ssrc)
+		} else {
+			// Nothing from this source this tick, let its meter fall back
+			sourceMeter.Update(0, 0)
+			m.idleTicks[ssrc]++
+			if m.idleTicks[ssrc] >= sourceIdleTicks {
+				// Gone quiet (left, or rejoined under a new SSRC), it is re-added on its next frame
+				delete(m.userBuffers, ssrc)
+				delete(m.sources, ssrc)
+				delete(m.idleTicks, ssrc)
+			}
 		}
 	}
+	peak, meanSquare := frameLevel(out)
+	m.master.Update(peak, meanSquare)
+	if m.replay != nil {
+		m.replay.addMix(out)
+	}
 	m.mutex.Unlock()
 
+	m.bufferDepth.Set(float64(depth))
+	m.peakLevel.Set(metrics.DBFS(peak))
+	m.rmsLevel.Set(metrics.DBFS(math.Sqrt(meanSquare)))
+
 	// 3. Serialize to Little Endian
 	// Critical: Allocate new slice for channel transmission to avoid race conditions with FFmpeg
 	outBytes := make([]byte, len(out)*2)
@@ -116,5 +175,42 @@ func (m *Mixer) mixTick(out []int16) {
 	case m.mixedOut <- outBytes:
 	default:
 		// Drop frame if consumer (FFmpeg) is lagging to avoid latency accumulation
+		m.dropped.Inc()
+	}
+}
+
+// frameLevel returns the linear peak and mean square of a PCM frame (1.0 = full scale).
+func frameLevel(frame []int16) (peak, meanSquare float64) {
+	if len(frame) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, sample := range frame {
+		v := math.Abs(float64(sample)) / 32768
+		if v > peak {
+			peak = v
+		}
+		sum += v * v
+	}
+	return peak, sum / float64(len(frame))
+}
+
+// MixerLevels is a snapshot of the live meters.
+type MixerLevels struct {
+	Master  Level
+	Sources map[uint32]Level // Keyed by SSRC
+}
+
+// Levels returns the current meter readings.
+func (m *Mixer) Levels() MixerLevels {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	levels := MixerLevels{
+		Master:  meterLevel(&m.master),
+		Sources: make(map[uint32]Level, len(m.sources)),
+	}
+	for ssrc, mt := range m.sources {
+		levels.Sources[ssrc] = meterLevel(mt)
 	}
+	return levels
 }
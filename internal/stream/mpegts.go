@@ -0,0 +1,207 @@
+package stream
+
+// Minimal MPEG-TS muxer for a single Opus stream, laid out as in the ETSI
+// Opus-in-TS specification (and as FFmpeg writes it): private stream_type 0x06
+// with an "Opus" registration descriptor and a DVB extension descriptor
+// carrying the channel config, one access unit per PES, each prefixed with
+// the Opus control header.
+
+const (
+	tsPacketSize = 188
+	tsPATPID     = 0x0000
+	tsPMTPID     = 0x1000
+	tsAudioPID   = 0x0100
+
+	tsTransportStreamID = 1
+	tsProgramNumber     = 1
+	tsStreamPrivate     = 0x06 // PES private data
+	tsStreamIDOpus      = 0xbd // private_stream_1
+
+	tsClock        = 90000                                       // PTS/PCR base clock
+	tsFrameTicks   = tsClock * int64(frameDuration) / 1000000000 // 1800 per 20ms frame
+	tsPTSOffset    = tsClock / 10                                // PTS runs 100ms ahead of PCR
+	tsPSIInterval  = 5                                           // PAT/PMT every 5 frames (100ms)
+	tsOpusChannels = 0x02                                        // channel_config_code: stereo
+)
+
+type tsMuxer struct {
+	frames     int64
+	continuity map[uint16]byte
+	out        []byte
+}
+
+func newTSMuxer() *tsMuxer {
+	return &tsMuxer{continuity: make(map[uint16]byte)}
+}
+
+// mux returns the TS packets carrying one Opus frame (plus PAT/PMT when due).
+// The result is only valid until the next call.
+func (m *tsMuxer) mux(opusPacket []byte) []byte {
+	m.out = m.out[:0]
+	if m.frames%tsPSIInterval == 0 {
+		m.writeSection(tsPATPID, m.pat())
+		m.writeSection(tsPMTPID, m.pmt())
+	}
+	pcr := m.frames * tsFrameTicks
+	m.writePES(m.pes(opusPacket, pcr+tsPTSOffset), pcr)
+	m.frames++
+	return m.out
+}
+
+// pes wraps one Opus access unit with its control header in a PES packet.
+func (m *tsMuxer) pes(opusPacket []byte, pts int64) []byte {
+	// Control header: 11 bit prefix 0x3ff, no trim or extension flags, then the
+	// AU size as a run of 0xff bytes plus the remainder
+	header := []byte{0x7f, 0xe0}
+	for n := len(opusPacket); ; n -= 255 {
+		if n < 255 {
+			header = append(header, byte(n))
+			break
+		}
+		header = append(header, 0xff)
+	}
+
+	payloadLen := len(header) + len(opusPacket)
+	pes := make([]byte, 0, 14+payloadLen)
+	pes = append(pes, 0x00, 0x00, 0x01, tsStreamIDOpus)
+	length := 3 + 5 + payloadLen // Flags, header length, PTS
+	pes = append(pes, byte(length>>8), byte(length))
+	pes = append(pes, 0x84, 0x80, 0x05) // data_alignment_indicator; PTS only
+	pes = append(pes,
+		0x21|byte(pts>>29)&0x0e,
+		byte(pts>>22),
+		0x01|byte(pts>>14)&0xfe,
+		byte(pts>>7),
+		0x01|byte(pts<<1)&0xfe,
+	)
+	pes = append(pes, header...)
+	return append(pes, opusPacket...)
+}
+
+// writePES splits a PES packet into TS packets; the first carries the PCR.
+func (m *tsMuxer) writePES(pes []byte, pcr int64) {
+	first := true
+	for len(pes) > 0 {
+		var adaptation []byte
+		if first {
+			// random_access_indicator, PCR (33 bit base, no extension)
+			adaptation = []byte{0x50,
+				byte(pcr >> 25), byte(pcr >> 17), byte(pcr >> 9), byte(pcr >> 1),
+				byte(pcr<<7) | 0x7e, 0x00}
+		}
+		room := tsPacketSize - 4
+		if adaptation != nil {
+			room -= 1 + len(adaptation)
+		}
+		if len(pes) < room {
+			// Pad the last packet through the adaptation field
+			stuffing := room - len(pes)
+			if adaptation == nil {
+				adaptation = []byte{}
+				stuffing-- // Length byte
+				if stuffing > 0 {
+					adaptation = append(adaptation, 0x00) // No flags
+					stuffing--
+				}
+			}
+			for ; stuffing > 0; stuffing-- {
+				adaptation = append(adaptation, 0xff)
+			}
+			room = len(pes)
+		}
+		m.writePacket(tsAudioPID, first, adaptation, pes[:room])
+		pes = pes[room:]
+		first = false
+	}
+}
+
+// writeSection writes a PSI section in a single TS packet.
+func (m *tsMuxer) writeSection(pid uint16, section []byte) {
+	payload := make([]byte, 0, tsPacketSize-4)
+	payload = append(payload, 0x00) // pointer_field
+	payload = append(payload, section...)
+	for len(payload) < tsPacketSize-4 {
+		payload = append(payload, 0xff)
+	}
+	m.writePacket(pid, true, nil, payload)
+}
+
+// writePacket appends one TS packet. adaptation is the adaptation field
+// without its length byte; an empty non-nil slice writes a zero length field.
+func (m *tsMuxer) writePacket(pid uint16, start bool, adaptation []byte, payload []byte) {
+	b0 := byte(pid>>8) & 0x1f
+	if start {
+		b0 |= 0x40
+	}
+	control := byte(0x10) // payload only
+	if adaptation != nil {
+		control = 0x30
+	}
+	cc := m.continuity[pid]
+	m.continuity[pid] = (cc + 1) & 0x0f
+
+	m.out = append(m.out, 0x47, b0, byte(pid), control|cc)
+	if adaptation != nil {
+		m.out = append(m.out, byte(len(adaptation)))
+		m.out = append(m.out, adaptation...)
+	}
+	m.out = append(m.out, payload...)
+}
+
+func (m *tsMuxer) pat() []byte {
+	return psiSection(0x00, tsTransportStreamID, []byte{
+		0x00, tsProgramNumber,
+		0xe0 | byte(tsPMTPID>>8), byte(tsPMTPID & 0xff),
+	})
+}
+
+func (m *tsMuxer) pmt() []byte {
+	return psiSection(0x02, tsProgramNumber, []byte{
+		0xe0 | byte(tsAudioPID>>8), byte(tsAudioPID & 0xff), // PCR_PID
+		0xf0, 0x00, // program_info_length
+		tsStreamPrivate,
+		0xe0 | byte(tsAudioPID>>8), byte(tsAudioPID & 0xff),
+		0xf0, 10, // ES_info_length
+		0x05, 4, 'O', 'p', 'u', 's', // registration_descriptor
+		0x7f, 2, 0x80, tsOpusChannels, // DVB extension descriptor: Opus channel config
+	})
+}
+
+// psiSection builds a long-form PSI section (version 0, single section) with CRC.
+func psiSection(tableID byte, tableIDExtension uint16, body []byte) []byte {
+	length := 5 + len(body) + 4
+	s := []byte{
+		tableID,
+		0xb0 | byte(length>>8), byte(length),
+		byte(tableIDExtension >> 8), byte(tableIDExtension),
+		0xc1, // version 0, current_next_indicator
+		0x00, 0x00,
+	}
+	s = append(s, body...)
+	crc := crc32MPEG(s)
+	return append(s, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+var crcTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return
+}()
+
+// crc32MPEG is the CRC-32/MPEG-2 used by PSI sections.
+func crc32MPEG(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
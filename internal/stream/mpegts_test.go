@@ -0,0 +1,220 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+// tsPacket is a parsed TS packet.
+type tsPacket struct {
+	pid        uint16
+	start      bool
+	cc         byte
+	adaptation []byte // nil without adaptation field, excluding the length byte
+	payload    []byte
+}
+
+// parseTS splits a muxer output into packets, checking the framing of each.
+func parseTS(t *testing.T, data []byte) []tsPacket {
+	t.Helper()
+	if len(data)%tsPacketSize != 0 {
+		t.Fatalf("output is %d bytes, not a multiple of %d", len(data), tsPacketSize)
+	}
+	var packets []tsPacket
+	for off := 0; off < len(data); off += tsPacketSize {
+		b := data[off : off+tsPacketSize]
+		if b[0] != 0x47 {
+			t.Fatalf("packet at %d starts with %#x, want sync byte 0x47", off, b[0])
+		}
+		p := tsPacket{
+			pid:   uint16(b[1]&0x1f)<<8 | uint16(b[2]),
+			start: b[1]&0x40 != 0,
+			cc:    b[3] & 0x0f,
+		}
+		rest := b[4:]
+		switch b[3] & 0x30 {
+		case 0x10:
+		case 0x30:
+			n := int(rest[0])
+			p.adaptation, rest = rest[1:1+n], rest[1+n:]
+		default:
+			t.Fatalf("packet at %d: adaptation_field_control %#x", off, b[3]&0x30)
+		}
+		p.payload = rest
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// readPTS decodes a 33 bit timestamp in PES header layout.
+func readPTS(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+func TestCRC32MPEG(t *testing.T) {
+	// Check value of CRC-32/MPEG-2
+	if got := crc32MPEG([]byte("123456789")); got != 0x0376e6e7 {
+		t.Errorf("crc32MPEG(check) = %#08x, want 0x0376e6e7", got)
+	}
+}
+
+func TestTSPacketsAndContinuity(t *testing.T) {
+	m := newTSMuxer()
+	last := make(map[uint16]int)
+	counts := make(map[uint16]int)
+	for frame := 0; frame < 100; frame++ {
+		// Sizes from one to five packets, so the audio PID advances unevenly
+		opus := bytes.Repeat([]byte{byte(frame)}, 100+frame*7)
+		for _, p := range parseTS(t, m.mux(opus)) {
+			if prev, ok := last[p.pid]; ok && int(p.cc) != (prev+1)%16 {
+				t.Fatalf("frame %d, PID %#x: continuity counter %d after %d", frame, p.pid, p.cc, prev)
+			}
+			last[p.pid] = int(p.cc)
+			counts[p.pid]++
+		}
+	}
+	for _, pid := range []uint16{tsPATPID, tsPMTPID, tsAudioPID} {
+		if counts[pid] <= 16 {
+			t.Errorf("PID %#x: only %d packets, counter never wrapped", pid, counts[pid])
+		}
+	}
+	if counts[tsPATPID] != counts[tsPMTPID] {
+		t.Errorf("%d PAT but %d PMT packets", counts[tsPATPID], counts[tsPMTPID])
+	}
+}
+
+func TestTSPSISections(t *testing.T) {
+	m := newTSMuxer()
+	packets := parseTS(t, m.mux([]byte{0xfc}))
+	if len(packets) != 3 || packets[0].pid != tsPATPID || packets[1].pid != tsPMTPID || packets[2].pid != tsAudioPID {
+		t.Fatalf("first frame: want PAT, PMT, audio packets, got %d packets", len(packets))
+	}
+	for _, p := range packets[:2] {
+		if !p.start || p.payload[0] != 0 {
+			t.Fatalf("PID %#x: want payload_unit_start and pointer_field 0", p.pid)
+		}
+		section := p.payload[1:]
+		length := int(section[1]&0x0f)<<8 | int(section[2])
+		section = section[:3+length]
+		// The CRC over a section including its CRC is zero
+		if crc := crc32MPEG(section); crc != 0 {
+			t.Errorf("PID %#x: section CRC check %#08x, want 0", p.pid, crc)
+		}
+		for _, b := range p.payload[1+len(section):] {
+			if b != 0xff {
+				t.Fatalf("PID %#x: stuffing byte %#x after the section", p.pid, b)
+			}
+		}
+	}
+
+	pat := packets[0].payload[1:]
+	if pat[0] != 0x00 || uint16(pat[10]&0x1f)<<8|uint16(pat[11]) != tsPMTPID {
+		t.Errorf("PAT: table %#x, PMT PID %#x", pat[0], uint16(pat[10]&0x1f)<<8|uint16(pat[11]))
+	}
+	pmt := packets[1].payload[1:]
+	if pmt[0] != 0x02 || pmt[12] != tsStreamPrivate || !bytes.Contains(pmt, []byte{0x05, 4, 'O', 'p', 'u', 's'}) {
+		t.Errorf("PMT: table %#x, stream type %#x, Opus registration missing", pmt[0], pmt[12])
+	}
+
+	// PSI is repeated every tsPSIInterval frames only
+	for frame := 1; frame < tsPSIInterval; frame++ {
+		if n := len(m.mux([]byte{0xfc})) / tsPacketSize; n != 1 {
+			t.Errorf("frame %d: %d packets, want audio only", frame, n)
+		}
+	}
+	if n := len(m.mux([]byte{0xfc})) / tsPacketSize; n != 3 {
+		t.Errorf("frame %d: %d packets, want PAT, PMT and audio", tsPSIInterval, n)
+	}
+}
+
+func TestTSOpusControlHeader(t *testing.T) {
+	tests := []struct {
+		size   int
+		header []byte
+	}{
+		{254, []byte{0x7f, 0xe0, 0xfe}},
+		{255, []byte{0x7f, 0xe0, 0xff, 0x00}},
+		{510, []byte{0x7f, 0xe0, 0xff, 0xff, 0x00}},
+	}
+	m := newTSMuxer()
+	for _, tt := range tests {
+		opus := bytes.Repeat([]byte{0xab}, tt.size)
+		pes := m.pes(opus, 9000)
+		if got := pes[14 : 14+len(tt.header)]; !bytes.Equal(got, tt.header) {
+			t.Errorf("%d byte AU: control header % x, want % x", tt.size, got, tt.header)
+		}
+		if !bytes.Equal(pes[14+len(tt.header):], opus) {
+			t.Errorf("%d byte AU: payload not intact after the header", tt.size)
+		}
+		if length := int(pes[4])<<8 | int(pes[5]); length != len(pes)-6 {
+			t.Errorf("%d byte AU: PES_packet_length %d, want %d", tt.size, length, len(pes)-6)
+		}
+	}
+}
+
+func TestTSPESStuffing(t *testing.T) {
+	// The first packet carries the 8 byte PCR adaptation field: 176 bytes of PES fit
+	const firstRoom = tsPacketSize - 4 - 8
+	const pesOverhead = 14 + 3 // PES header with PTS, control header of a <255 byte AU
+
+	tests := []struct {
+		name          string
+		opusSize      int
+		packets       int
+		lastAdaptLen  int // -1: no adaptation field in the last packet
+		lastStuffByte int // Stuffing bytes (0xff) in the last packet
+	}{
+		{"exactly one packet", firstRoom - pesOverhead, 1, 7, 0},
+		{"one byte short", firstRoom - pesOverhead - 1, 1, 8, 1},
+		{"exactly two packets", firstRoom + 184 - pesOverhead - 1, 2, -1, 0}, // 4 byte control header
+		{"second short by one", firstRoom + 183 - pesOverhead - 1, 2, 0, 0},
+		{"second short by two", firstRoom + 182 - pesOverhead - 1, 2, 1, 0},
+		{"second short by ten", firstRoom + 174 - pesOverhead - 1, 2, 9, 8},
+	}
+	for _, tt := range tests {
+		m := newTSMuxer()
+		m.frames = 1 // Skip PAT/PMT
+		opus := bytes.Repeat([]byte{0x5a}, tt.opusSize)
+		out := m.mux(opus)
+		packets := parseTS(t, out)
+		if len(packets) != tt.packets {
+			t.Errorf("%s: %d packets, want %d", tt.name, len(packets), tt.packets)
+			continue
+		}
+
+		first := packets[0]
+		if !first.start || len(first.adaptation) < 7 || first.adaptation[0]&0x10 == 0 {
+			t.Errorf("%s: first packet without payload start or PCR", tt.name)
+			continue
+		}
+		a := first.adaptation
+		pcr := int64(a[1])<<25 | int64(a[2])<<17 | int64(a[3])<<9 | int64(a[4])<<1 | int64(a[5]>>7)
+		if pcr != tsFrameTicks {
+			t.Errorf("%s: PCR %d, want %d", tt.name, pcr, tsFrameTicks)
+		}
+
+		last := packets[len(packets)-1]
+		switch {
+		case tt.lastAdaptLen < 0 && last.adaptation != nil:
+			t.Errorf("%s: last packet has a %d byte adaptation field, want none", tt.name, len(last.adaptation))
+		case tt.lastAdaptLen >= 0 && (last.adaptation == nil || len(last.adaptation) != tt.lastAdaptLen):
+			t.Errorf("%s: last packet adaptation field %v, want %d bytes", tt.name, last.adaptation, tt.lastAdaptLen)
+		}
+		stuffing := bytes.Count(last.adaptation, []byte{0xff})
+		if stuffing != tt.lastStuffByte {
+			t.Errorf("%s: %d stuffing bytes, want %d", tt.name, stuffing, tt.lastStuffByte)
+		}
+
+		// Reassembled, the payloads are exactly the PES packet
+		var pes []byte
+		for _, p := range packets {
+			pes = append(pes, p.payload...)
+		}
+		if want := m.pes(opus, tsFrameTicks+tsPTSOffset); !bytes.Equal(pes, want) {
+			t.Errorf("%s: reassembled PES differs (%d bytes, want %d)", tt.name, len(pes), len(want))
+		}
+		if pts := readPTS(pes[9:14]); pts != tsFrameTicks+tsPTSOffset {
+			t.Errorf("%s: PTS %d, want %d", tt.name, pts, tsFrameTicks+tsPTSOffset)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"encoding/binary"
+	"math/rand"
+)
+
+// Ogg/Opus stream writer (RFC 7845), one page per 20ms packet. A title change
+// ends the logical stream and starts a new chained one whose OpusTags carry
+// the title, which is how Ogg players pick up new metadata. Players briefly
+// stall on every chain, so titles are applied at most every 15s of audio.
+
+const (
+	oggPreSkip = 312 // libopus encoder lookahead at 48kHz
+	oggVendor  = "VLX_AudioBridge"
+
+	oggMinChainGranule = 15 * 48000 // Minimum length of a logical stream before a title change
+
+	oggFlagBOS = 0x02
+	oggFlagEOS = 0x04
+)
+
+type oggOpusWriter struct {
+	serial   uint32
+	sequence uint32
+	granule  int64
+	title    string
+	pending  *string // Title for the next chained stream, the latest one wins
+	started  bool
+	out      []byte
+}
+
+func newOggOpusWriter(title string) *oggOpusWriter {
+	return &oggOpusWriter{title: title}
+}
+
+// setTitle chains a new logical stream with the title after the next packet,
+// or once the current stream is 15s long.
+func (w *oggOpusWriter) setTitle(title string) {
+	switch {
+	case !w.started:
+		w.title = title
+	case title != w.title:
+		w.pending = &title
+	default:
+		// Changed back before the pending title was applied
+		w.pending = nil
+	}
+}
+
+// write returns the pages for one Opus packet, including stream headers when
+// a (new) logical stream starts. The result is only valid until the next call.
+func (w *oggOpusWriter) write(opusPacket []byte) []byte {
+	return w.writePacket(opusPacket, false)
+}
+
+// end returns the pages for the last Opus packet, closing the logical stream.
+func (w *oggOpusWriter) end(opusPacket []byte) []byte {
+	return w.writePacket(opusPacket, true)
+}
+
+func (w *oggOpusWriter) writePacket(opusPacket []byte, last bool) []byte {
+	w.out = w.out[:0]
+	if !w.started {
+		w.begin()
+	}
+	w.granule += frameSamples
+	chain := w.pending != nil && !last && w.granule >= oggMinChainGranule
+	flags := byte(0)
+	if chain || last {
+		flags = oggFlagEOS
+	}
+	w.page(flags, w.granule, opusPacket)
+	if chain {
+		w.title, w.pending = *w.pending, nil
+		w.begin()
+	}
+	return w.out
+}
+
+// begin writes the OpusHead and OpusTags pages of a new logical stream.
+func (w *oggOpusWriter) begin() {
+	w.serial = rand.Uint32()
+	w.sequence = 0
+	w.granule = 0
+	w.started = true
+
+	head := []byte("OpusHead")
+	head = append(head, 1, 2) // Version, channels
+	head = binary.LittleEndian.AppendUint16(head, oggPreSkip)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0) // Output gain, channel mapping family 0
+	w.page(oggFlagBOS, 0, head)
+
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(oggVendor)))
+	tags = append(tags, oggVendor...)
+	var comments []string
+	if w.title != "" {
+		comments = append(comments, "TITLE="+w.title)
+	}
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(comments)))
+	for _, c := range comments {
+		tags = binary.LittleEndian.AppendUint32(tags, uint32(len(c)))
+		tags = append(tags, c...)
+	}
+	w.page(0, 0, tags)
+}
+
+// page appends one page holding a single packet (at most 255*255 bytes).
+func (w *oggOpusWriter) page(flags byte, granule int64, packet []byte) {
+	start := len(w.out)
+	w.out = append(w.out, 'O', 'g', 'g', 'S', 0, flags)
+	w.out = binary.LittleEndian.AppendUint64(w.out, uint64(granule))
+	w.out = binary.LittleEndian.AppendUint32(w.out, w.serial)
+	w.out = binary.LittleEndian.AppendUint32(w.out, w.sequence)
+	w.out = append(w.out, 0, 0, 0, 0) // CRC, filled in below
+
+	// Lacing: 255 for every full segment, then the remainder (0 if a multiple of 255)
+	segments := len(packet)/255 + 1
+	w.out = append(w.out, byte(segments))
+	for i := 0; i < segments-1; i++ {
+		w.out = append(w.out, 255)
+	}
+	w.out = append(w.out, byte(len(packet)%255))
+	w.out = append(w.out, packet...)
+
+	binary.LittleEndian.PutUint32(w.out[start+22:], oggCRC(w.out[start:]))
+	w.sequence++
+}
+
+// oggCRC is the Ogg page checksum: the MPEG-2 CRC polynomial with a zero initial value.
+func oggCRC(data []byte) uint32 {
+	crc := uint32(0)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
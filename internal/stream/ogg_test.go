@@ -0,0 +1,215 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// oggPage is a parsed Ogg page.
+type oggPage struct {
+	flags    byte
+	granule  int64
+	serial   uint32
+	sequence uint32
+	lacing   []byte
+	body     []byte
+}
+
+// parseOgg splits writer output into pages, checking capture pattern, lacing and CRC.
+func parseOgg(t *testing.T, data []byte) []oggPage {
+	t.Helper()
+	var pages []oggPage
+	for len(data) > 0 {
+		if len(data) < 27 || string(data[:4]) != "OggS" || data[4] != 0 {
+			t.Fatalf("page %d: bad capture pattern or version", len(pages))
+		}
+		n := int(data[26])
+		lacing := data[27 : 27+n]
+		size := 0
+		for _, l := range lacing {
+			size += int(l)
+		}
+		end := 27 + n + size
+		if end > len(data) {
+			t.Fatalf("page %d: body of %d bytes past the end", len(pages), size)
+		}
+
+		page := append([]byte(nil), data[:end]...)
+		stored := binary.LittleEndian.Uint32(page[22:])
+		copy(page[22:26], []byte{0, 0, 0, 0})
+		if crc := bitwiseOggCRC(page); crc != stored {
+			t.Fatalf("page %d: CRC %#08x, want %#08x", len(pages), stored, crc)
+		}
+
+		pages = append(pages, oggPage{
+			flags:    data[5],
+			granule:  int64(binary.LittleEndian.Uint64(data[6:])),
+			serial:   binary.LittleEndian.Uint32(data[14:]),
+			sequence: binary.LittleEndian.Uint32(data[18:]),
+			lacing:   lacing,
+			body:     data[27+n : end],
+		})
+		data = data[end:]
+	}
+	return pages
+}
+
+// bitwiseOggCRC is a reference implementation of the Ogg CRC, independent of crcTable.
+func bitwiseOggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func TestOggCRC(t *testing.T) {
+	// CRC-32 with the MPEG-2 polynomial, zero init and no final XOR (CRC-32/CKSUM without its XOR)
+	if got := oggCRC([]byte("123456789")); got != 0x89a1897f {
+		t.Errorf("oggCRC(check) = %#08x, want 0x89a1897f", got)
+	}
+	// Page written by the writer: the CRC field covers the page with the field zeroed
+	w := newOggOpusWriter("")
+	pages := parseOgg(t, w.write([]byte{0xfc, 0xff, 0xfe}))
+	if len(pages) != 3 {
+		t.Fatalf("first packet: %d pages, want OpusHead, OpusTags and audio", len(pages))
+	}
+}
+
+func TestOggLacing(t *testing.T) {
+	tests := []struct {
+		size   int
+		lacing []byte
+	}{
+		{0, []byte{0}},
+		{1, []byte{1}},
+		{254, []byte{254}},
+		{255, []byte{255, 0}},
+		{256, []byte{255, 1}},
+		{510, []byte{255, 255, 0}},
+		{600, []byte{255, 255, 90}},
+	}
+	for _, tt := range tests {
+		w := newOggOpusWriter("")
+		w.write([]byte{0xfc}) // Headers out of the way
+		packet := bytes.Repeat([]byte{0x42}, tt.size)
+		pages := parseOgg(t, w.write(packet))
+		if len(pages) != 1 {
+			t.Fatalf("%d byte packet: %d pages, want 1", tt.size, len(pages))
+		}
+		if !bytes.Equal(pages[0].lacing, tt.lacing) {
+			t.Errorf("%d byte packet: lacing %v, want %v", tt.size, pages[0].lacing, tt.lacing)
+		}
+		if !bytes.Equal(pages[0].body, packet) {
+			t.Errorf("%d byte packet: body differs", tt.size)
+		}
+	}
+}
+
+// oggTitle returns the TITLE comment of an OpusTags packet, "" if none.
+func oggTitle(t *testing.T, tags []byte) string {
+	t.Helper()
+	if !bytes.HasPrefix(tags, []byte("OpusTags")) {
+		t.Fatalf("not an OpusTags packet")
+	}
+	p := tags[8:]
+	vendor := binary.LittleEndian.Uint32(p)
+	p = p[4+vendor:]
+	count := binary.LittleEndian.Uint32(p)
+	p = p[4:]
+	for i := uint32(0); i < count; i++ {
+		n := binary.LittleEndian.Uint32(p)
+		c := string(p[4 : 4+n])
+		p = p[4+n:]
+		if len(c) > 6 && c[:6] == "TITLE=" {
+			return c[6:]
+		}
+	}
+	return ""
+}
+
+func TestOggStreamHeaders(t *testing.T) {
+	w := newOggOpusWriter("Show")
+	pages := parseOgg(t, w.write([]byte{0xfc}))
+	if len(pages) != 3 {
+		t.Fatalf("%d pages, want 3", len(pages))
+	}
+	head, tags, audio := pages[0], pages[1], pages[2]
+	if head.flags != oggFlagBOS || !bytes.HasPrefix(head.body, []byte("OpusHead")) || head.granule != 0 {
+		t.Errorf("first page: flags %#x, granule %d, want BOS OpusHead at 0", head.flags, head.granule)
+	}
+	if tags.flags != 0 || oggTitle(t, tags.body) != "Show" {
+		t.Errorf("second page: flags %#x, title %q, want OpusTags with TITLE=Show", tags.flags, oggTitle(t, tags.body))
+	}
+	if audio.flags != 0 || audio.granule != frameSamples {
+		t.Errorf("audio page: flags %#x, granule %d, want %d", audio.flags, audio.granule, frameSamples)
+	}
+	for i, p := range pages {
+		if p.serial != head.serial || p.sequence != uint32(i) {
+			t.Errorf("page %d: serial %#x sequence %d", i, p.serial, p.sequence)
+		}
+	}
+
+	last := parseOgg(t, w.end([]byte{0xfc}))
+	if len(last) != 1 || last[0].flags != oggFlagEOS || last[0].serial != head.serial {
+		t.Errorf("end: want a single EOS page of the same stream")
+	}
+}
+
+func TestOggTitleChain(t *testing.T) {
+	chainFrames := int(oggMinChainGranule / frameSamples)
+	packet := []byte{0xfc}
+
+	w := newOggOpusWriter("A")
+	first := parseOgg(t, w.write(packet))
+	serial := first[0].serial
+
+	// Titles set before the stream is chainable: the latest wins, none is applied early
+	w.setTitle("B")
+	w.setTitle("C")
+	for frame := 2; frame < chainFrames; frame++ {
+		pages := parseOgg(t, w.write(packet))
+		if len(pages) != 1 || pages[0].flags != 0 || pages[0].serial != serial {
+			t.Fatalf("frame %d: stream chained before %d frames", frame, chainFrames)
+		}
+	}
+
+	pages := parseOgg(t, w.write(packet))
+	if len(pages) != 3 {
+		t.Fatalf("frame %d: %d pages, want EOS, OpusHead, OpusTags", chainFrames, len(pages))
+	}
+	eos, head, tags := pages[0], pages[1], pages[2]
+	if eos.flags != oggFlagEOS || eos.serial != serial || eos.granule != oggMinChainGranule {
+		t.Errorf("chain: last page of old stream flags %#x granule %d", eos.flags, eos.granule)
+	}
+	if head.flags != oggFlagBOS || head.serial == serial || head.sequence != 0 || head.granule != 0 {
+		t.Errorf("chain: new stream flags %#x serial %#x sequence %d granule %d", head.flags, head.serial, head.sequence, head.granule)
+	}
+	if title := oggTitle(t, tags.body); title != "C" {
+		t.Errorf("chain: title %q, want the latest (C)", title)
+	}
+
+	// Changed and changed back before the chain is due: nothing happens
+	w.setTitle("D")
+	w.setTitle("C")
+	for frame := 0; frame < 2*chainFrames; frame++ {
+		if pages := parseOgg(t, w.write(packet)); len(pages) != 1 || pages[0].serial != head.serial {
+			t.Fatalf("frame %d after chain: unexpected chain for an unchanged title", frame)
+		}
+	}
+
+	// Once the stream is long enough, a change chains after the next packet
+	w.setTitle("E")
+	pages = parseOgg(t, w.write(packet))
+	if len(pages) != 3 || oggTitle(t, pages[2].body) != "E" {
+		t.Errorf("late change: %d pages, want an immediate chain with TITLE=E", len(pages))
+	}
+}
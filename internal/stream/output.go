@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Output is a destination of the mixed stream. Write receives one 20ms frame of
+// interleaved 48kHz stereo s16le PCM per call.
+type Output interface {
+	Start() error
+	Write(pcm []byte) (int, error)
+	Alive() bool
+	Stop()
+}
+
+// metadataOutput is implemented by outputs that carry a stream title.
+type metadataOutput interface {
+	SetMetadata(title string)
+}
+
+// newOutput builds the output implementation for the configured type.
+func newOutput(log *slog.Logger, cfg config.OutputConfig) (Output, error) {
+	switch cfg.Type {
+	case config.OutputSRT, "":
+		if nativeSRT(cfg) {
+			return NewSRTOutput(log, cfg)
+		}
+		return NewFFmpegProcess(log, cfg)
+	case config.OutputWHIP:
+		return NewWHIPOutput(log, cfg)
+	case config.OutputIcecast:
+		return NewIcecastOutput(log, cfg)
+	case config.OutputHLS:
+		return NewHLSOutput(log, cfg)
+	default:
+		return nil, fmt.Errorf("unknown output type %q", cfg.Type)
+	}
+}
+
+const (
+	outputQueueFrames = 10 // 200ms of audio per output before frames are dropped
+	outputMinBackoff  = time.Second
+	outputMaxBackoff  = 30 * time.Second
+)
+
+// outputRunner keeps one output running, recreating it with backoff when it
+// fails, so a dead destination never stalls the mix or the other outputs.
+type outputRunner struct {
+	name     string
+	config   config.OutputConfig
+	log      *slog.Logger
+	frames   chan []byte
+	alive    atomic.Bool
+	restarts prometheus.Counter
+	dropped  prometheus.Counter
+
+	metaMutex   sync.Mutex
+	metadata    string        // Latest title, reapplied after restarts
+	metaChanged chan struct{} // Signals pump to apply a new title
+}
+
+func newOutputRunner(guildID string, log *slog.Logger, index int, cfg config.OutputConfig) *outputRunner {
+	name := fmt.Sprintf("%s-%d", cfg.Type, index)
+	return &outputRunner{
+		name:        name,
+		config:      cfg,
+		log:         log.With("output", name),
+		frames:      make(chan []byte, outputQueueFrames),
+		metaChanged: make(chan struct{}, 1),
+		restarts:    metrics.OutputRestarts.WithLabelValues(guildID, name),
+		dropped:     metrics.OutputFramesDropped.WithLabelValues(guildID, name),
+	}
+}
+
+// send queues a frame without blocking the mixer.
+func (r *outputRunner) send(frame []byte) {
+	select {
+	case r.frames <- frame:
+	default:
+		r.dropped.Inc()
+	}
+}
+
+// setMetadata records the stream title; outputs without metadata ignore it.
+func (r *outputRunner) setMetadata(title string) {
+	r.metaMutex.Lock()
+	changed := title != r.metadata
+	r.metadata = title
+	r.metaMutex.Unlock()
+	if changed {
+		select {
+		case r.metaChanged <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *outputRunner) applyMetadata(out Output) {
+	mo, ok := out.(metadataOutput)
+	if !ok {
+		return
+	}
+	r.metaMutex.Lock()
+	title := r.metadata
+	r.metaMutex.Unlock()
+	if title != "" {
+		mo.SetMetadata(title)
+	}
+}
+
+func (r *outputRunner) run(stop <-chan struct{}) {
+	backoff := outputMinBackoff
+	started := false
+	for {
+		out, err := newOutput(r.log, r.config)
+		if err == nil {
+			if err = out.Start(); err != nil {
+				out.Stop()
+			}
+		}
+		if err == nil {
+			if started {
+				r.restarts.Inc()
+				r.log.Info("Output restarted")
+			} else {
+				r.log.Info("Output started", "url", r.config.URL)
+			}
+			started = true
+
+			startedAt := time.Now()
+			r.alive.Store(true)
+			err = r.pump(out, stop)
+			r.alive.Store(false)
+			out.Stop()
+			if err == nil {
+				return
+			}
+			// A long healthy run starts over with a short retry
+			if time.Since(startedAt) > outputMaxBackoff {
+				backoff = outputMinBackoff
+			}
+		}
+
+		r.log.Error("Output failed", "err", err, "retry_in", backoff)
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, outputMaxBackoff)
+	}
+}
+
+// pump feeds queued frames to the output until it fails (error) or stop is closed (nil).
+func (r *outputRunner) pump(out Output, stop <-chan struct{}) error {
+	check := time.NewTicker(time.Second)
+	defer check.Stop()
+	r.applyMetadata(out)
+	for {
+		select {
+		case <-stop:
+			return nil
+		case frame := <-r.frames:
+			if _, err := out.Write(frame); err != nil {
+				return err
+			}
+		case <-r.metaChanged:
+			r.applyMetadata(out)
+		case <-check.C:
+			if !out.Alive() {
+				return errors.New("output stopped")
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const replayDefaultMinutes = 2
+
+// replaySource is one source's frame (gain applied, as mixed) in a tick.
+type replaySource struct {
+	ssrc uint32
+	pcm  []int16
+}
+
+type replaySlot struct {
+	mix     []int16
+	sources []replaySource // Only with per_user
+}
+
+// replayBuffer keeps the last minutes of mixer ticks for instant replay clips.
+// Slots are reused in place, so steady-state recording doesn't allocate.
+type replayBuffer struct {
+	mutex   sync.Mutex
+	slots   []replaySlot // One spare slot: the one the current tick writes into
+	next    int
+	filled  int
+	perUser bool
+}
+
+func newReplayBuffer(minutes int, perUser bool) *replayBuffer {
+	frames := minutes * int(time.Minute/frameDuration)
+	return &replayBuffer{slots: make([]replaySlot, frames+1), perUser: perUser}
+}
+
+// seconds returns how much the buffer holds when full.
+func (r *replayBuffer) seconds() int {
+	return (len(r.slots) - 1) / int(time.Second/frameDuration)
+}
+
+// addSource records a source's frame for the current tick (per_user only).
+func (r *replayBuffer) addSource(ssrc uint32, pcm []int16) {
+	if !r.perUser {
+		return
+	}
+	if len(pcm) > FrameSize*Channels {
+		// Longer packets are truncated in the mix as well
+		pcm = pcm[:FrameSize*Channels]
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	slot := &r.slots[r.next]
+	n := len(slot.sources)
+	if n < cap(slot.sources) {
+		slot.sources = slot.sources[:n+1]
+	} else {
+		slot.sources = append(slot.sources, replaySource{})
+	}
+	src := &slot.sources[n]
+	src.ssrc = ssrc
+	src.pcm = append(src.pcm[:0], pcm...)
+}
+
+// addMix records the mixed frame and ends the current tick.
+func (r *replayBuffer) addMix(mix []int16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	slot := &r.slots[r.next]
+	slot.mix = append(slot.mix[:0], mix...)
+	r.next = (r.next + 1) % len(r.slots)
+	r.slots[r.next].sources = r.slots[r.next].sources[:0]
+	if r.filled < len(r.slots)-1 {
+		r.filled++
+	}
+}
+
+// last returns copies of up to frames most recent ticks, oldest first: the mix
+// and, with per_user, every source's frames (nil where it was silent).
+func (r *replayBuffer) last(frames int) ([][]int16, map[uint32][][]int16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if frames > r.filled {
+		frames = r.filled
+	}
+	mix := make([][]int16, frames)
+	sources := make(map[uint32][][]int16)
+	start := r.next - frames + len(r.slots)
+	for i := 0; i < frames; i++ {
+		slot := &r.slots[(start+i)%len(r.slots)]
+		mix[i] = append([]int16(nil), slot.mix...)
+		for _, src := range slot.sources {
+			track, ok := sources[src.ssrc]
+			if !ok {
+				track = make([][]int16, frames)
+				sources[src.ssrc] = track
+			}
+			track[i] = append([]int16(nil), src.pcm...)
+		}
+	}
+	return mix, sources
+}
+
+// Clip is one encoded track of an instant replay.
+type Clip struct {
+	Name string // File name, e.g. "mix.ogg"
+	Data []byte // Ogg/Opus
+}
+
+// Clip encodes the last seconds of the mix as Ogg/Opus and returns the tracks
+// with the length they cover (less than asked when the buffer is shorter).
+// With per_user, every speaker's own track follows the mix, most active first.
+func (m *Manager) Clip(seconds int) ([]Clip, time.Duration, error) {
+	if m.mixer.replay == nil {
+		return nil, 0, fmt.Errorf("replay buffer is disabled")
+	}
+	if seconds <= 0 {
+		return nil, 0, fmt.Errorf("clip length must be positive")
+	}
+	// Also keeps the frame count below from overflowing
+	if limit := m.mixer.replay.seconds(); seconds > limit {
+		seconds = limit
+	}
+	mix, sources := m.mixer.replay.last(seconds * int(time.Second/frameDuration))
+	if len(mix) == 0 {
+		return nil, 0, fmt.Errorf("replay buffer is empty")
+	}
+	length := time.Duration(len(mix)) * frameDuration
+
+	data, err := encodeClip(m.config.Bitrate, "Replay", mix)
+	if err != nil {
+		return nil, 0, err
+	}
+	clips := []Clip{{Name: "mix.ogg", Data: data}}
+
+	type track struct {
+		ssrc   uint32
+		frames [][]int16
+		active int
+	}
+	tracks := make([]track, 0, len(sources))
+	for ssrc, frames := range sources {
+		t := track{ssrc: ssrc, frames: frames}
+		for _, f := range frames {
+			if f != nil {
+				t.active++
+			}
+		}
+		tracks = append(tracks, t)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		if tracks[i].active != tracks[j].active {
+			return tracks[i].active > tracks[j].active
+		}
+		return tracks[i].ssrc < tracks[j].ssrc
+	})
+	used := map[string]bool{"mix": true}
+	for _, t := range tracks {
+		name := m.trackName(t.ssrc)
+		data, err := encodeClip(m.config.Bitrate, name, t.frames)
+		if err != nil {
+			return nil, 0, err
+		}
+		file := unsafeFileChars.ReplaceAllString(name, "_")
+		for i := 2; used[file]; i++ {
+			file = fmt.Sprintf("%s_%d", unsafeFileChars.ReplaceAllString(name, "_"), i)
+		}
+		used[file] = true
+		clips = append(clips, Clip{Name: file + ".ogg", Data: data})
+	}
+	return clips, length, nil
+}
+
+// ReplaySeconds returns the length of the replay buffer, 0 if disabled.
+func (m *Manager) ReplaySeconds() int {
+	if m.mixer.replay == nil {
+		return 0
+	}
+	return m.mixer.replay.seconds()
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// trackName names a source's track after the speaker's display name.
+func (m *Manager) trackName(ssrc uint32) string {
+	if ssrc == LocalSSRC {
+		return "bridge"
+	}
+	m.usersMutex.Lock()
+	userID := m.ssrcUsers[ssrc]
+	m.usersMutex.Unlock()
+	if userID == "" {
+		return fmt.Sprintf("ssrc_%d", ssrc)
+	}
+	m.metaMutex.Lock()
+	resolve := m.resolveName
+	m.metaMutex.Unlock()
+	if resolve != nil {
+		if name := resolve(userID); name != "" {
+			return name
+		}
+	}
+	return userID
+}
+
+// encodeClip encodes frames (nil = silence) to an Ogg/Opus file with title as TITLE tag.
+func encodeClip(bitrate, title string, frames [][]int16) ([]byte, error) {
+	encoder, err := newFrameEncoder(bitrate)
+	if err != nil {
+		return nil, err
+	}
+	ogg := newOggOpusWriter(title)
+	pcm := make([]byte, FrameSize*Channels*2)
+	var out bytes.Buffer
+	for i, frame := range frames {
+		for j := range pcm {
+			pcm[j] = 0
+		}
+		for j, sample := range frame {
+			binary.LittleEndian.PutUint16(pcm[j*2:], uint16(sample))
+		}
+		packet, err := encoder.encode(pcm)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(frames)-1 {
+			out.Write(ogg.end(packet))
+		} else {
+			out.Write(ogg.write(packet))
+		}
+	}
+	return out.Bytes(), nil
+}
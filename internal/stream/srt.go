@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+
+	"VLX_AudioBridge/internal/config"
+	srt "github.com/datarhei/gosrt"
+)
+
+// Up to 7 TS packets per SRT message, the usual live payload size (pkt_size=1316).
+const srtChunkSize = 7 * tsPacketSize
+
+// SRTOutput publishes the mix as Opus in MPEG-TS over SRT without FFmpeg.
+type SRTOutput struct {
+	log     *slog.Logger
+	config  config.OutputConfig
+	encoder *frameEncoder
+	muxer   *tsMuxer
+	conn    srt.Conn
+	failed  atomic.Bool
+}
+
+// nativeSRT reports whether an srt output should use SRTOutput rather than FFmpeg.
+// Without an explicit engine, only srt:// URLs in caller mode are handled natively.
+func nativeSRT(cfg config.OutputConfig) bool {
+	switch cfg.Engine {
+	case config.EngineNative:
+		return true
+	case config.EngineFFmpeg:
+		return false
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "srt" {
+		return false
+	}
+	mode := u.Query().Get("mode")
+	return mode == "" || mode == "caller"
+}
+
+// NewSRTOutput prepares a native SRT publisher for cfg.URL. Nothing is sent until Start.
+func NewSRTOutput(log *slog.Logger, cfg config.OutputConfig) (*SRTOutput, error) {
+	encoder, err := newFrameEncoder(cfg.Bitrate)
+	if err != nil {
+		return nil, err
+	}
+	return &SRTOutput{
+		log:     log,
+		config:  cfg,
+		encoder: encoder,
+		muxer:   newTSMuxer(),
+	}, nil
+}
+
+// Start connects to the SRT listener in caller mode.
+func (s *SRTOutput) Start() error {
+	srtConfig := srt.DefaultConfig()
+	address, err := srtConfig.UnmarshalURL(s.config.URL)
+	if err != nil {
+		return fmt.Errorf("invalid SRT URL: %w", err)
+	}
+	if mode := urlQuery(s.config.URL, "mode"); mode != "" && mode != "caller" {
+		return fmt.Errorf("SRT mode %q is not supported natively, use engine: ffmpeg", mode)
+	}
+	conn, err := srt.Dial("srt", address, srtConfig)
+	if err != nil {
+		// Rejections (e.g. unknown streamid, bad passphrase) are reported here
+		return fmt.Errorf("SRT connect to %s failed: %w", address, err)
+	}
+	s.conn = conn
+	s.log.Info("SRT connected", "address", address, "stream_id", srtConfig.StreamId, "bitrate", s.encoder.bitrate)
+	return nil
+}
+
+// Write encodes one 20ms PCM frame, muxes it and sends the TS packets.
+func (s *SRTOutput) Write(pcmData []byte) (int, error) {
+	packet, err := s.encoder.encode(pcmData)
+	if err != nil {
+		return 0, err
+	}
+	ts := s.muxer.mux(packet)
+	for len(ts) > 0 {
+		n := min(len(ts), srtChunkSize)
+		if _, err := s.conn.Write(ts[:n]); err != nil {
+			s.failed.Store(true)
+			return 0, fmt.Errorf("SRT write failed: %w", err)
+		}
+		ts = ts[n:]
+	}
+	return len(pcmData), nil
+}
+
+// Alive reports false once the connection failed.
+func (s *SRTOutput) Alive() bool {
+	return !s.failed.Load()
+}
+
+func (s *SRTOutput) Stop() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func urlQuery(rawURL, key string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get(key)
+}
@@ -0,0 +1,214 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+const (
+	whipGatherTimeout  = 5 * time.Second  // Offer is sent with whatever candidates were found by then
+	whipConnectTimeout = 15 * time.Second // ICE + DTLS must complete within this after the answer
+	whipRequestTimeout = 10 * time.Second
+)
+
+// WHIPOutput publishes the mix as an Opus track over WebRTC using WHIP
+// (RFC 9725): one SDP offer POSTed to the endpoint, the answer in the response,
+// and a DELETE on the returned resource URL to end the session.
+type WHIPOutput struct {
+	log     *slog.Logger
+	config  config.OutputConfig
+	client  *http.Client
+	encoder *frameEncoder
+
+	pc       *webrtc.PeerConnection
+	track    *webrtc.TrackLocalStaticSample
+	resource string // Session URL from the Location header
+
+	mutex      sync.Mutex
+	state      webrtc.PeerConnectionState
+	answeredAt time.Time
+	stopOnce   sync.Once
+}
+
+// NewWHIPOutput prepares a WHIP publisher for cfg.URL. Nothing is sent until Start.
+func NewWHIPOutput(log *slog.Logger, cfg config.OutputConfig) (*WHIPOutput, error) {
+	encoder, err := newFrameEncoder(cfg.Bitrate)
+	if err != nil {
+		return nil, err
+	}
+	return &WHIPOutput{
+		log:     log,
+		config:  cfg,
+		client:  &http.Client{Timeout: whipRequestTimeout},
+		encoder: encoder,
+		state:   webrtc.PeerConnectionStateNew,
+	}, nil
+}
+
+// Start negotiates the WebRTC session with the WHIP endpoint.
+func (w *WHIPOutput) Start() error {
+	iceServers := []webrtc.ICEServer{}
+	if len(w.config.ICEServers) > 0 {
+		iceServers = append(iceServers, webrtc.ICEServer{URLs: w.config.ICEServers})
+	}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: iceServers})
+	if err != nil {
+		return fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	w.pc = pc
+
+	w.track, err = webrtc.NewTrackLocalStaticSample(
+		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		"audio", "vlx-audiobridge")
+	if err != nil {
+		return fmt.Errorf("failed to create audio track: %w", err)
+	}
+	transceiver, err := pc.AddTransceiverFromTrack(w.track,
+		webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+	if err != nil {
+		return fmt.Errorf("failed to add audio track: %w", err)
+	}
+	// RTCP must be read for the interceptors (NACK, reports) to run
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := transceiver.Sender().Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		w.mutex.Lock()
+		w.state = s
+		w.mutex.Unlock()
+		w.log.Info("WHIP connection state", "state", s.String())
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	select {
+	case <-gathered:
+	case <-time.After(whipGatherTimeout):
+		w.log.Warn("ICE gathering incomplete, sending partial offer")
+	}
+
+	answer, err := w.post(pc.LocalDescription().SDP)
+	if err != nil {
+		return err
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}); err != nil {
+		return fmt.Errorf("invalid WHIP answer: %w", err)
+	}
+
+	w.mutex.Lock()
+	w.answeredAt = time.Now()
+	w.mutex.Unlock()
+	w.log.Info("WHIP session created", "resource", w.resource, "bitrate", w.encoder.bitrate)
+	return nil
+}
+
+// post sends the SDP offer and returns the answer, recording the session resource URL.
+func (w *WHIPOutput) post(offer string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, strings.NewReader(offer))
+	if err != nil {
+		return "", fmt.Errorf("invalid WHIP endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/sdp")
+	w.authorize(req)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("WHIP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read WHIP answer: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("WHIP endpoint returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	// The session URL may be relative to the endpoint
+	if location := resp.Header.Get("Location"); location != "" {
+		if ref, err := url.Parse(location); err == nil {
+			w.resource = resp.Request.URL.ResolveReference(ref).String()
+		}
+	}
+	return string(body), nil
+}
+
+func (w *WHIPOutput) authorize(req *http.Request) {
+	if w.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.config.Token)
+	}
+}
+
+// Write encodes one 20ms PCM frame and sends it on the track.
+func (w *WHIPOutput) Write(pcmData []byte) (int, error) {
+	packet, err := w.encoder.encode(pcmData)
+	if err != nil {
+		return 0, err
+	}
+	// The sample is copied into RTP packets, so the buffer can be reused
+	if err := w.track.WriteSample(media.Sample{Data: packet, Duration: frameDuration}); err != nil {
+		return 0, err
+	}
+	return len(pcmData), nil
+}
+
+// Alive reports false once the connection failed, closed, or never connected in time.
+func (w *WHIPOutput) Alive() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	switch w.state {
+	case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+		return false
+	case webrtc.PeerConnectionStateConnected:
+		return true
+	}
+	return w.answeredAt.IsZero() || time.Since(w.answeredAt) < whipConnectTimeout
+}
+
+// Stop ends the WHIP session (best effort) and closes the peer connection.
+func (w *WHIPOutput) Stop() {
+	w.stopOnce.Do(func() {
+		if w.resource != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), whipRequestTimeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodDelete, w.resource, nil)
+			if err == nil {
+				w.authorize(req)
+				if resp, err := w.client.Do(req); err != nil {
+					w.log.Warn("WHIP session delete failed", "err", err)
+				} else {
+					resp.Body.Close()
+				}
+			}
+		}
+		if w.pc != nil {
+			if err := w.pc.Close(); err != nil {
+				w.log.Warn("Error closing peer connection", "err", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"VLX_AudioBridge/internal/config"
+	"github.com/pion/webrtc/v4"
+)
+
+// whipServer is a minimal WHIP endpoint: it answers the offer with a pion peer
+// connection, records the requests and reports the first RTP packet received.
+type whipServer struct {
+	t *testing.T
+
+	mutex    sync.Mutex
+	requests []string // "METHOD path"
+	auth     []string // Authorization header of every request
+	pcs      []*webrtc.PeerConnection
+
+	rtp chan int // Payload size of the first RTP packet
+}
+
+func newWHIPServer(t *testing.T) (*whipServer, *httptest.Server) {
+	ws := &whipServer{t: t, rtp: make(chan int, 1)}
+	srv := httptest.NewServer(ws)
+	t.Cleanup(func() {
+		srv.Close()
+		ws.mutex.Lock()
+		defer ws.mutex.Unlock()
+		for _, pc := range ws.pcs {
+			pc.Close()
+		}
+	})
+	return ws, srv
+}
+
+func (ws *whipServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws.mutex.Lock()
+	ws.requests = append(ws.requests, r.Method+" "+r.URL.Path)
+	ws.auth = append(ws.auth, r.Header.Get("Authorization"))
+	ws.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/whip":
+		if got := r.Header.Get("Content-Type"); got != "application/sdp" {
+			http.Error(w, "unexpected content type "+got, http.StatusUnsupportedMediaType)
+			return
+		}
+		offer, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		answer, err := ws.answer(string(offer))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Relative, the publisher must resolve it against the endpoint
+		w.Header().Set("Location", "session/1")
+		w.Header().Set("Content-Type", "application/sdp")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, answer)
+	case r.Method == http.MethodDelete && r.URL.Path == "/session/1":
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+func (ws *whipServer) answer(offer string) (string, error) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return "", err
+	}
+	ws.mutex.Lock()
+	ws.pcs = append(ws.pcs, pc)
+	ws.mutex.Unlock()
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if !strings.EqualFold(track.Codec().MimeType, webrtc.MimeTypeOpus) {
+			ws.t.Errorf("track codec %s, want Opus", track.Codec().MimeType)
+		}
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		select {
+		case ws.rtp <- len(packet.Payload):
+		default:
+		}
+		// Keep draining so the sender isn't blocked
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	<-gathered
+	return pc.LocalDescription().SDP, nil
+}
+
+func (ws *whipServer) snapshot() (requests, auth []string) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	return append([]string(nil), ws.requests...), append([]string(nil), ws.auth...)
+}
+
+// toneFrame returns one 20ms mixed frame of a 440Hz tone.
+func toneFrame(n int) []byte {
+	frame := make([]byte, frameSamples*Channels*2)
+	for i := 0; i < frameSamples; i++ {
+		t := float64(n*frameSamples+i) / SampleRate
+		sample := uint16(int16(8000 * math.Sin(2*math.Pi*440*t)))
+		binary.LittleEndian.PutUint16(frame[i*4:], sample)
+		binary.LittleEndian.PutUint16(frame[i*4+2:], sample)
+	}
+	return frame
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestWHIPPublish(t *testing.T) {
+	ws, srv := newWHIPServer(t)
+
+	out, err := NewWHIPOutput(testLogger(), config.OutputConfig{Type: "whip", URL: srv.URL + "/whip", Bitrate: "64k", Token: "secret"})
+	if err != nil {
+		t.Fatalf("NewWHIPOutput: %v", err)
+	}
+	if err := out.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer out.Stop()
+	if want := srv.URL + "/session/1"; out.resource != want {
+		t.Errorf("resource %q, want %q", out.resource, want)
+	}
+
+	// Frames are written at the mixer's pace until the answerer sees RTP
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+	deadline := time.After(10 * time.Second)
+	for n, received := 0, false; !received; n++ {
+		select {
+		case size := <-ws.rtp:
+			if size == 0 {
+				t.Error("first RTP packet has an empty payload")
+			}
+			received = true
+		case <-deadline:
+			t.Fatal("no RTP packet received within 10s")
+		case <-ticker.C:
+			if _, err := out.Write(toneFrame(n)); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+	}
+	if !out.Alive() {
+		t.Error("Alive() = false while publishing")
+	}
+
+	out.Stop()
+	requests, auth := ws.snapshot()
+	if want := []string{"POST /whip", "DELETE /session/1"}; strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests %q, want %q", requests, want)
+	}
+	for i, a := range auth {
+		if a != "Bearer secret" {
+			t.Errorf("request %d: Authorization %q, want bearer token", i, a)
+		}
+	}
+}
+
+func TestWHIPRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "stream key invalid", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	out, err := NewWHIPOutput(testLogger(), config.OutputConfig{Type: "whip", URL: srv.URL + "/whip", Bitrate: "64k"})
+	if err != nil {
+		t.Fatalf("NewWHIPOutput: %v", err)
+	}
+	defer out.Stop()
+	err = out.Start()
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "stream key invalid") {
+		t.Fatalf("Start: got %v, want the endpoint's 403 and message", err)
+	}
+	if out.resource != "" {
+		t.Errorf("resource %q after a rejected offer", out.resource)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+
+	"VLX_AudioBridge/internal/logging"
 )
 
+var logger = logging.For(logging.System)
+
 const (
 	SinkName        = "VLX_VirtualSink"
 	SinkDescription = "VLX_Overlay_Audio"
@@ -35,9 +39,9 @@ func SetupPipewire() error {
 		if err := createCmd.Run(); err != nil {
 			return fmt.Errorf("failed to create Virtual Sink: %w", err)
 		}
-		fmt.Println("[System] Virtual Sink created:", SinkName)
+		logger.Info("Virtual Sink created", "sink", SinkName)
 	} else {
-		fmt.Println("[System] Virtual Sink already configured.")
+		logger.Info("Virtual Sink already configured", "sink", SinkName)
 	}
 
 	// 4. Force Default Source
@@ -45,10 +49,22 @@ func SetupPipewire() error {
 	monitorName := SinkName + ".monitor"
 	setDefaultCmd := exec.Command("pactl", "set-default-source", monitorName)
 	if err := setDefaultCmd.Run(); err != nil {
-		fmt.Printf("[System] Warning: Failed to set default source to %s: %v\n", monitorName, err)
+		logger.Warn("Failed to set default source", "source", monitorName, "err", err)
 	} else {
-		fmt.Printf("[System] Default source set to: %s\n", monitorName)
+		logger.Info("Default source set", "source", monitorName)
 	}
 
 	return nil
 }
+
+// SinkAvailable reports whether the virtual sink the overlays play into still exists.
+func SinkAvailable() error {
+	output, err := exec.Command("pactl", "list", "sinks", "short").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list sinks: %w", err)
+	}
+	if !strings.Contains(string(output), SinkName) {
+		return fmt.Errorf("sink %s not found", SinkName)
+	}
+	return nil
+}
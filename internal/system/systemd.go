@@ -0,0 +1,51 @@
+package system
+
+import (
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// NotifyReady tells systemd (Type=notify) that startup is complete.
+// It is a no-op when not started by systemd.
+func NotifyReady() {
+	if _, err := daemon.SdNotify(false, daemon.SdNotifyReady); err != nil {
+		logger.Warn("sd_notify READY failed", "err", err)
+	}
+}
+
+// NotifyStopping tells systemd that a graceful shutdown has begun.
+func NotifyStopping() {
+	daemon.SdNotify(false, daemon.SdNotifyStopping)
+}
+
+// RunWatchdog pings the systemd watchdog (WatchdogSec) at half the configured
+// interval while alive() reports true, so a stuck bridge is restarted.
+// alive should check the process only: restarting doesn't fix a gateway outage.
+// Returns immediately if the watchdog is not enabled for this unit.
+func RunWatchdog(alive func() bool, stop <-chan struct{}) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		logger.Error("Invalid systemd watchdog settings", "err", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	logger.Info("systemd watchdog enabled", "interval", interval)
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !alive() {
+				logger.Warn("Liveness check failed, withholding watchdog ping.")
+				continue
+			}
+			daemon.SdNotify(false, daemon.SdNotifyWatchdog)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tts
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// EspeakEngine shells out to espeak-ng.
+type EspeakEngine struct {
+	Binary string
+	Voice  string
+}
+
+func (e *EspeakEngine) Synthesize(text string) ([]float32, error) {
+	return synthesizeToWAV(func(wavPath string) *exec.Cmd {
+		args := []string{"-w", wavPath}
+		if e.Voice != "" {
+			args = append(args, "-v", e.Voice)
+		}
+		// "--" keeps announcements starting with a dash from being parsed as flags
+		args = append(args, "--", text)
+		return exec.Command(e.Binary, args...)
+	})
+}
+
+// PiperEngine shells out to piper, feeding the text on stdin.
+type PiperEngine struct {
+	Binary string
+	Model  string
+}
+
+func (p *PiperEngine) Synthesize(text string) ([]float32, error) {
+	return synthesizeToWAV(func(wavPath string) *exec.Cmd {
+		cmd := exec.Command(p.Binary, "--model", p.Model, "--output_file", wavPath)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd
+	})
+}
+
+// synthesizeToWAV runs an engine writing a temporary WAV file and converts the result.
+func synthesizeToWAV(build func(wavPath string) *exec.Cmd) ([]float32, error) {
+	f, err := os.CreateTemp("", "vlx_tts_*.wav")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temp file: %w", err)
+	}
+	wavPath := f.Name()
+	f.Close()
+	defer os.Remove(wavPath)
+
+	cmd := build(wavPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w (%s)", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return convertWAV(wavPath)
+}
@@ -0,0 +1,32 @@
+package tts
+
+import (
+	"math"
+	"time"
+)
+
+// ToneEngine is a stub engine returning a synthetic sine tone instead of speech.
+// It needs no external binaries and is meant for checking the announcement path end to end.
+type ToneEngine struct {
+	Frequency float64
+}
+
+func (t *ToneEngine) Synthesize(text string) ([]float32, error) {
+	// Tone length follows the text length, 50ms per character within 0.2s..3s
+	duration := time.Duration(len(text)) * 50 * time.Millisecond
+	if duration < 200*time.Millisecond {
+		duration = 200 * time.Millisecond
+	} else if duration > 3*time.Second {
+		duration = 3 * time.Second
+	}
+
+	frames := int(duration.Seconds() * SampleRate)
+	pcm := make([]float32, frames*Channels)
+	for i := 0; i < frames; i++ {
+		v := float32(0.3 * math.Sin(2*math.Pi*t.Frequency*float64(i)/SampleRate))
+		for c := 0; c < Channels; c++ {
+			pcm[i*Channels+c] = v
+		}
+	}
+	return pcm, nil
+}
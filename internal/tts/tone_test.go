@@ -0,0 +1,65 @@
+package tts
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"VLX_AudioBridge/internal/config"
+)
+
+func TestNewSelectsTone(t *testing.T) {
+	engine, err := New(config.TTSConfig{Engine: "tone"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, ok := engine.(*ToneEngine); !ok {
+		t.Fatalf("New returned %T, want *ToneEngine", engine)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if engine, err := New(config.TTSConfig{}); engine != nil || err != nil {
+		t.Errorf("empty engine: got %v, %v; want TTS disabled", engine, err)
+	}
+	if _, err := New(config.TTSConfig{Engine: "piper"}); err == nil {
+		t.Error("piper without model: want error")
+	}
+	if _, err := New(config.TTSConfig{Engine: "festival"}); err == nil {
+		t.Error("unknown engine: want error")
+	}
+}
+
+func TestToneSynthesize(t *testing.T) {
+	engine := &ToneEngine{Frequency: 440}
+	tests := []struct {
+		text    string
+		seconds float64
+	}{
+		{"", 0.2},                     // Clamped to the minimum
+		{"hello world", 0.55},         // 50ms per character
+		{strings.Repeat("a", 100), 3}, // Clamped to the maximum
+	}
+	for _, tt := range tests {
+		pcm, err := engine.Synthesize(tt.text)
+		if err != nil {
+			t.Fatalf("Synthesize(%q): %v", tt.text, err)
+		}
+		want := int(tt.seconds*SampleRate) * Channels
+		if len(pcm) != want {
+			t.Errorf("Synthesize(%q): %d samples, want %d", tt.text, len(pcm), want)
+		}
+
+		// Interleaved stereo with identical channels, within the engine's headroom
+		peak := 0.0
+		for i := 0; i+1 < len(pcm); i += Channels {
+			if pcm[i] != pcm[i+1] {
+				t.Fatalf("Synthesize(%q): channels differ at frame %d", tt.text, i/Channels)
+			}
+			peak = math.Max(peak, math.Abs(float64(pcm[i])))
+		}
+		if peak < 0.29 || peak > 0.301 {
+			t.Errorf("Synthesize(%q): peak %.3f, want ~0.3", tt.text, peak)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tts
+
+import (
+	"fmt"
+
+	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/overlay"
+)
+
+const (
+	SampleRate = overlay.SampleRate
+	Channels   = overlay.Channels
+)
+
+// Engine synthesizes text into 48kHz interleaved stereo float32 PCM, ready for the ingress encoder.
+type Engine interface {
+	Synthesize(text string) ([]float32, error)
+}
+
+// New returns the engine selected in config, or nil if TTS is disabled.
+func New(cfg config.TTSConfig) (Engine, error) {
+	switch cfg.Engine {
+	case "":
+		return nil, nil
+	case "espeak-ng":
+		return &EspeakEngine{Binary: binaryOr(cfg.Binary, "espeak-ng"), Voice: cfg.Voice}, nil
+	case "piper":
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("piper requires a model path")
+		}
+		return &PiperEngine{Binary: binaryOr(cfg.Binary, "piper"), Model: cfg.Model}, nil
+	case "tone":
+		return &ToneEngine{Frequency: 440}, nil
+	default:
+		return nil, fmt.Errorf("unknown TTS engine %q", cfg.Engine)
+	}
+}
+
+func binaryOr(binary, fallback string) string {
+	if binary != "" {
+		return binary
+	}
+	return fallback
+}
+
+// convertWAV resamples a WAV file produced by an engine to 48kHz stereo float32 PCM.
+func convertWAV(path string) ([]float32, error) {
+	pcm, err := overlay.DecodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("engine produced no audio")
+	}
+	return pcm, nil
+}
@@ -2,66 +2,86 @@ package main
 
 import (
 	"flag"
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"VLX_AudioBridge/internal/api"
 	"VLX_AudioBridge/internal/bot"
 	"VLX_AudioBridge/internal/config"
+	"VLX_AudioBridge/internal/logging"
 	"VLX_AudioBridge/internal/overlay"
-	"VLX_AudioBridge/internal/stream"
 	"VLX_AudioBridge/internal/system"
 )
 
+var logger = logging.For(logging.Main)
+
 func main() {
 	// 1. Parse command line arguments
 	configPath := flag.String("config", "AudioBridge.yaml", "Path to configuration file")
 	flag.Parse()
 
 	// 2. Load Configuration
-	log.Println("[INFO]: Loading configuration...")
+	logger.Info("Loading configuration...", "path", *configPath)
 	if err := config.LoadConfig(*configPath); err != nil {
-		log.Fatalf("[ERR]: Critical error loading config: %v", err)
+		logging.Fatal(logger, "Critical error loading config", "err", err)
+	}
+	if err := logging.Setup(config.Cfg.Logging); err != nil {
+		logging.Fatal(logger, "Invalid logging config", "err", err)
 	}
 
 	// 3. System Audio Setup (Pipewire/PulseAudio)
-	log.Println("[INFO]: Verifying audio system status...")
+	logger.Info("Verifying audio system status...")
 	if err := system.SetupPipewire(); err != nil {
-		log.Fatalf("[ERR]: Pipewire setup failed: %v", err)
+		logging.Fatal(logger, "Pipewire setup failed", "err", err)
 	}
 
 	// 4. Initialize Overlay Manager (Headless Browsers)
-	log.Println("[INFO]: Initializing overlay manager...")
-	if err := overlay.Start(config.Cfg.Overlays.URLs); err != nil {
-		log.Fatalf("[ERR]: Failed to start overlays: %v", err)
+	logger.Info("Initializing overlay manager...")
+	if err := overlay.Start(config.Cfg.Overlays.All()); err != nil {
+		logging.Fatal(logger, "Failed to start overlays", "err", err)
 	}
 	// Ensure browsers are terminated on exit
 	defer overlay.Stop()
 
-	// 5. Initialize Streaming Manager
-	streamManager := stream.NewManager(config.Cfg.Streaming)
-
-	// 6. Graceful Shutdown Handler (Initialized early to pass to Bot)
+	// 5. Graceful Shutdown Handler (Initialized early to pass to Bot)
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
-	// 7. Initialize and Launch Discord Bot
-	log.Println("[INFO]: Launching Discord bot...")
-	discordBot, err := bot.New(config.Cfg, streamManager, sc)
+	// 6. Initialize and Launch Discord Bot
+	// Each guild bridge owns its own streaming manager (mixer + outputs)
+	logger.Info("Launching Discord bot...")
+	discordBot, err := bot.New(config.Cfg, sc)
 	if err != nil {
-		log.Fatalf("[ERR]: Failed to create Discord bot instance: %v", err)
+		logging.Fatal(logger, "Failed to create Discord bot instance", "err", err)
 	}
 
 	if err := discordBot.Open(); err != nil {
-		log.Fatalf("[ERR]: Failed to establish Discord connection: %v", err)
+		logging.Fatal(logger, "Failed to establish Discord connection", "err", err)
 	}
 	defer discordBot.Close()
 
-	log.Println("[INFO]: VLX_AudioBridge is running. Press CTRL+C to exit.")
+	// 7. Local HTTP control API (optional)
+	if config.Cfg.HTTP.Bind != "" {
+		apiServer := api.New(config.Cfg.HTTP, discordBot)
+		if err := apiServer.Start(); err != nil {
+			logging.Fatal(logger, "Failed to start HTTP API", "err", err)
+		}
+		defer apiServer.Stop()
+	}
+
+	// 8. systemd integration (no-op outside a Type=notify unit)
+	system.NotifyReady()
+	watchdogStop := make(chan struct{})
+	defer close(watchdogStop)
+	go system.RunWatchdog(func() bool { return discordBot.Responsive(5 * time.Second) }, watchdogStop)
+
+	logger.Info("VLX_AudioBridge is running. Press CTRL+C to exit.")
 
-	// 8. Wait for shutdown signal (from OS or Bot)
+	// 9. Wait for shutdown signal (from OS or Bot)
 	<-sc
 
-	log.Println("[INFO]: Shutdown signal received. Exiting...")
+	logger.Info("Shutdown signal received. Exiting...")
+	system.NotifyStopping()
 }